@@ -28,7 +28,15 @@ func (b *Builder) Prepare(raws ...interface{}) (generatedVars []string, warnings
 	}
 
 	return []string{
+		"BaseImageDigest",
+		"ContainerID",
+		"ContainerName",
+		"ExportPath",
+		"ExportSha256",
+		"ImageDigest",
+		"ImageID",
 		"ImageSha256",
+		"PodmanVersion",
 	}, warnings, nil
 }
 
@@ -47,10 +55,15 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	// Setup the driver that will talk to Podman
 	state.Put("driver", driver)
 
+	run := &StepRun{}
 	steps := []multistep.Step{
 		&StepTempDir{},
+		&StepLogin{},
+		&StepCleanupOrphans{},
 		&StepPull{},
-		&StepRun{},
+		run,
+		&StepSetGeneratedData{GeneratedData: generatedData},
+		&StepWaitReady{},
 		&communicator.StepConnect{
 			Config:    &b.config.Comm,
 			Host:      commHost(b.config.Comm.Host()),
@@ -70,24 +83,28 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	} else if b.config.Commit {
 		log.Print("[DEBUG] Container will be committed")
 		steps = append(steps, &StepSetDefaults{})
-		steps = append(steps,
-			new(StepCommit),
-			&StepSetGeneratedData{ // Adds ImageSha256 variable available after StepCommit
-				GeneratedData: generatedData,
-			})
+		steps = append(steps, new(StepCleanup), new(StepStop), new(StepCommit))
 	} else if b.config.ExportPath != "" {
 		log.Printf("[DEBUG] Container will be exported to %s", b.config.ExportPath)
-		steps = append(steps, new(StepExport))
+		steps = append(steps, new(StepCleanup), new(StepStop), new(StepExport))
 	} else {
 		return nil, errArtifactNotUsed
 	}
 
+	// Adds the variables about the artifact, like ImageSha256
+	steps = append(steps, &StepSetGeneratedData{GeneratedData: generatedData})
+
 	// Run!
 	b.runner = commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
 	b.runner.Run(ctx, state)
 
 	// If there was an error, return that
 	if err, ok := state.GetOk("error"); ok {
+		// The cleanup of the steps is skipped when aborting, so the
+		// container is still around.
+		if run.containerId != "" {
+			ui.Say(keptContainerMessage(run.containerId, state.Get("temp_dir").(string)))
+		}
 		return nil, err.(error)
 	}
 
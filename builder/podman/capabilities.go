@@ -0,0 +1,104 @@
+package podman
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// minPodmanVersion is the oldest podman supported by the builder, the first
+// one having all the flags it uses, like --mount type=image on podman run,
+// --time on podman rm and --policy on podman pull.
+const minPodmanVersion = "4.0.0"
+
+// Capabilities describe the podman the builder runs, so that features can be
+// gated on what it supports.
+type Capabilities struct {
+	// ClientVersion is the version of the podman command.
+	ClientVersion *version.Version
+	// ServerVersion is the version of the podman service the command talks
+	// to with podman --remote, or the client version otherwise.
+	ServerVersion *version.Version
+	// Rootless is true if podman runs the containers as a regular user.
+	Rootless bool
+	// CgroupVersion is the version of cgroups of the host, 1 or 2.
+	CgroupVersion int
+	// OCIRuntime is the name of the OCI runtime, like crun or runc.
+	OCIRuntime string
+}
+
+// versionOutput is the output of podman version --format json.
+type versionOutput struct {
+	Client struct {
+		Version string
+	}
+	Server *struct {
+		Version string
+	}
+}
+
+// infoOutput is the part of the output of podman info --format json the
+// capabilities are read from.
+type infoOutput struct {
+	Host struct {
+		CgroupVersion string `json:"cgroupVersion"`
+		OCIRuntime    struct {
+			Name string `json:"name"`
+		} `json:"ociRuntime"`
+		Security struct {
+			Rootless bool `json:"rootless"`
+		} `json:"security"`
+	} `json:"host"`
+}
+
+// parseCapabilities reads the capabilities from the JSON outputs of podman
+// version and podman info.
+func parseCapabilities(versionJSON, infoJSON []byte) (*Capabilities, error) {
+	var v versionOutput
+	if err := json.Unmarshal(versionJSON, &v); err != nil {
+		return nil, fmt.Errorf("Error decoding podman version: %s", err) //nolint:staticcheck
+	}
+	var info infoOutput
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		return nil, fmt.Errorf("Error decoding podman info: %s", err) //nolint:staticcheck
+	}
+
+	var caps Capabilities
+	var err error
+	if caps.ClientVersion, err = version.NewVersion(v.Client.Version); err != nil {
+		return nil, fmt.Errorf("Unknown podman version %q: %s", v.Client.Version, err) //nolint:staticcheck
+	}
+	caps.ServerVersion = caps.ClientVersion
+	if v.Server != nil {
+		if caps.ServerVersion, err = version.NewVersion(v.Server.Version); err != nil {
+			return nil, fmt.Errorf("Unknown podman server version %q: %s", v.Server.Version, err) //nolint:staticcheck
+		}
+	}
+
+	caps.Rootless = info.Host.Security.Rootless
+	caps.CgroupVersion = 1
+	if strings.TrimPrefix(info.Host.CgroupVersion, "v") == "2" {
+		caps.CgroupVersion = 2
+	}
+	caps.OCIRuntime = info.Host.OCIRuntime.Name
+
+	return &caps, nil
+}
+
+// Supported returns an error if podman is older than the oldest supported
+// version.
+func (c *Capabilities) Supported() error {
+	minimum := version.Must(version.NewVersion(minPodmanVersion))
+	if c.ServerVersion.LessThan(minimum) {
+		return fmt.Errorf("Podman %s is not supported, version %s or later is required", c.ServerVersion, minPodmanVersion) //nolint:staticcheck
+	}
+	return nil
+}
+
+// CanPause returns true if podman can pause containers, which rootless
+// podman can only do with cgroups v2.
+func (c *Capabilities) CanPause() bool {
+	return !c.Rootless || c.CgroupVersion == 2
+}
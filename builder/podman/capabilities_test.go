@@ -0,0 +1,75 @@
+package podman
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	versionJSON := `{"Client":{"APIVersion":"4.9.3","Version":"4.9.3","GoVersion":"go1.22.2","OsArch":"linux/amd64"}}`
+	infoJSON := `{"host":{"cgroupVersion":"v2","ociRuntime":{"name":"crun","path":"/usr/bin/crun"},"security":{"rootless":true}}}`
+
+	caps, err := parseCapabilities([]byte(versionJSON), []byte(infoJSON))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if caps.ClientVersion.String() != "4.9.3" || caps.ServerVersion.String() != "4.9.3" {
+		t.Fatalf("bad versions: %s %s", caps.ClientVersion, caps.ServerVersion)
+	}
+	if !caps.Rootless || caps.CgroupVersion != 2 || caps.OCIRuntime != "crun" {
+		t.Fatalf("bad capabilities: %#v", caps)
+	}
+
+	// podman --remote reports the version of the service
+	versionJSON = `{"Client":{"Version":"5.0.0"},"Server":{"Version":"4.4.1"}}`
+	infoJSON = `{"host":{"cgroupVersion":"v1","ociRuntime":{"name":"runc"},"security":{"rootless":false}}}`
+	caps, err = parseCapabilities([]byte(versionJSON), []byte(infoJSON))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if caps.ClientVersion.String() != "5.0.0" || caps.ServerVersion.String() != "4.4.1" {
+		t.Fatalf("bad versions: %s %s", caps.ClientVersion, caps.ServerVersion)
+	}
+	if caps.Rootless || caps.CgroupVersion != 1 || caps.OCIRuntime != "runc" {
+		t.Fatalf("bad capabilities: %#v", caps)
+	}
+
+	for _, tc := range [][2]string{
+		{`not json`, infoJSON},
+		{versionJSON, `not json`},
+		{`{"Client":{"Version":"dev"}}`, infoJSON},
+	} {
+		if _, err := parseCapabilities([]byte(tc[0]), []byte(tc[1])); err == nil {
+			t.Fatalf("%s: should error", tc[0])
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := &Capabilities{ServerVersion: version.Must(version.NewVersion("4.4.1"))}
+	if err := caps.Supported(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	caps.ServerVersion = version.Must(version.NewVersion("3.4.4"))
+	if err := caps.Supported(); err == nil {
+		t.Fatal("should error")
+	}
+
+	cases := []struct {
+		rootless bool
+		cgroup   int
+		pause    bool
+	}{
+		{rootless: false, cgroup: 1, pause: true},
+		{rootless: false, cgroup: 2, pause: true},
+		{rootless: true, cgroup: 1, pause: false},
+		{rootless: true, cgroup: 2, pause: true},
+	}
+	for _, tc := range cases {
+		caps := &Capabilities{Rootless: tc.rootless, CgroupVersion: tc.cgroup}
+		if caps.CanPause() != tc.pause {
+			t.Fatalf("rootless %t, cgroups v%d: bad: %t", tc.rootless, tc.cgroup, caps.CanPause())
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package podman
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// supportedInstructions are the instructions accepted by
+// `podman commit --change`.
+var supportedInstructions = []string{
+	"CMD",
+	"ENTRYPOINT",
+	"ENV",
+	"EXPOSE",
+	"LABEL",
+	"ONBUILD",
+	"STOPSIGNAL",
+	"USER",
+	"VOLUME",
+	"WORKDIR",
+}
+
+// dockerOnlyInstructions are the changes that can't be stored in an image
+// using the OCI format.
+var dockerOnlyInstructions = []string{"ONBUILD"}
+
+var (
+	envKeyRegexp     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	exposeRegexp     = regexp.MustCompile(`^([0-9]+)(?:-([0-9]+))?(?:/(tcp|udp|sctp))?$`)
+	stopSignalRegexp = regexp.MustCompile(`^(SIG)?[A-Z][A-Z0-9]*([+-][0-9]+)?$`)
+)
+
+// change is a single Podmanfile instruction of the changes option.
+type change struct {
+	// Instruction is the upper-cased instruction, e.g. CMD.
+	Instruction string
+	// Args is everything after the instruction, with the surrounding
+	// whitespace removed.
+	Args string
+}
+
+// parseChange splits a change into its instruction and arguments.
+func parseChange(s string) change {
+	s = strings.TrimSpace(s)
+	instruction, args := s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		instruction, args = s[:i], s[i+1:]
+	}
+
+	return change{
+		Instruction: strings.ToUpper(instruction),
+		Args:        strings.TrimSpace(args),
+	}
+}
+
+// isExecForm returns true if the arguments are a JSON array, like
+// `CMD ["nginx", "-g", "daemon off;"]`.
+func (c change) isExecForm() bool {
+	return strings.HasPrefix(c.Args, "[")
+}
+
+// validateChange checks that the change is an instruction supported by podman
+// and that its arguments are well formed.
+func validateChange(s string) error {
+	c := parseChange(s)
+	if c.Instruction == "" {
+		return fmt.Errorf("empty change")
+	}
+
+	if !slices.Contains(supportedInstructions, c.Instruction) {
+		return fmt.Errorf("unsupported instruction %s, must be one of %s",
+			c.Instruction, strings.Join(supportedInstructions, ", "))
+	}
+
+	if c.Args == "" {
+		return fmt.Errorf("%s requires at least one argument", c.Instruction)
+	}
+
+	switch c.Instruction {
+	case "CMD", "ENTRYPOINT", "VOLUME":
+		if c.isExecForm() {
+			var args []string
+			if err := json.Unmarshal([]byte(c.Args), &args); err != nil {
+				return fmt.Errorf("%s must be a JSON array of strings: %s", c.Instruction, err)
+			}
+		}
+	case "ENV":
+		words, err := splitWords(c.Args)
+		if err != nil {
+			return fmt.Errorf("ENV: %s", err)
+		}
+		if !strings.Contains(words[0], "=") {
+			// Legacy `ENV KEY VALUE` form
+			if !envKeyRegexp.MatchString(words[0]) {
+				return fmt.Errorf("ENV: invalid variable name %q", words[0])
+			}
+			if len(words) < 2 {
+				return fmt.Errorf("ENV %s requires a value", words[0])
+			}
+			break
+		}
+		for _, w := range words {
+			key, _, ok := strings.Cut(w, "=")
+			if !ok || !envKeyRegexp.MatchString(key) {
+				return fmt.Errorf("ENV: %q must be in the KEY=VALUE form", w)
+			}
+		}
+	case "EXPOSE":
+		for _, p := range strings.Fields(c.Args) {
+			if err := validatePort(p); err != nil {
+				return fmt.Errorf("EXPOSE: %s", err)
+			}
+		}
+	case "LABEL":
+		words, err := splitWords(c.Args)
+		if err != nil {
+			return fmt.Errorf("LABEL: %s", err)
+		}
+		for _, w := range words {
+			if key, _, ok := strings.Cut(w, "="); !ok || key == "" {
+				return fmt.Errorf("LABEL: %q must be in the key=value form", w)
+			}
+		}
+	case "ONBUILD":
+		switch trigger := parseChange(c.Args).Instruction; trigger {
+		case "ONBUILD", "FROM", "MAINTAINER":
+			return fmt.Errorf("ONBUILD can't trigger %s", trigger)
+		}
+	case "STOPSIGNAL":
+		if n, err := strconv.Atoi(c.Args); err == nil {
+			if n < 1 || n > 64 {
+				return fmt.Errorf("STOPSIGNAL: invalid signal number %d", n)
+			}
+		} else if !stopSignalRegexp.MatchString(c.Args) {
+			return fmt.Errorf("STOPSIGNAL: invalid signal %q", c.Args)
+		}
+	case "USER", "WORKDIR":
+		words, err := splitWords(c.Args)
+		if err != nil {
+			return fmt.Errorf("%s: %s", c.Instruction, err)
+		}
+		if len(words) != 1 {
+			return fmt.Errorf("%s takes exactly one argument", c.Instruction)
+		}
+	}
+
+	return nil
+}
+
+// validatePort checks an EXPOSE argument: a port or port range with an
+// optional protocol, like 80, 8000-8080 or 53/udp.
+func validatePort(p string) error {
+	m := exposeRegexp.FindStringSubmatch(p)
+	if m == nil {
+		return fmt.Errorf("%q must be in the port[-port][/tcp|udp|sctp] form", p)
+	}
+
+	for _, s := range m[1:3] {
+		if s == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(s); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q: port %s out of range", p, s)
+		}
+	}
+
+	return nil
+}
+
+// splitWords splits the arguments of an instruction on whitespace, keeping
+// quoted strings together, like the Dockerfile parser does. Quotes are
+// removed from the returned words, and so are the backslashes escaping a
+// character outside quotes, or a `"`, `\` or `$` in double quotes.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune(`"\$`, r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if escaped {
+		word.WriteRune('\\')
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -0,0 +1,115 @@
+package podman
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChange(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected change
+	}{
+		{"CMD /bin/sh", change{"CMD", "/bin/sh"}},
+		{"  entrypoint\t[\"/bin/sh\", \"-c\"] ", change{"ENTRYPOINT", `["/bin/sh", "-c"]`}},
+		{"USER", change{"USER", ""}},
+		{"", change{"", ""}},
+	}
+
+	for _, tc := range cases {
+		if actual := parseChange(tc.input); actual != tc.expected {
+			t.Fatalf("bad: %q: expected %#v, got %#v", tc.input, tc.expected, actual)
+		}
+	}
+}
+
+func TestValidateChange(t *testing.T) {
+	good := []string{
+		`CMD ["nginx", "-g", "daemon off;"]`,
+		"CMD nginx -g daemon off;",
+		"cmd /bin/bash",
+		`ENTRYPOINT ["/bin/sh", "-c"]`,
+		"ENTRYPOINT /var/www/start.sh",
+		"ENV HOSTNAME www.example.com",
+		"ENV FOO=bar BAZ=\"a b\"",
+		"EXPOSE 80 443/tcp 53/udp 8000-8080",
+		"LABEL version=1.0 description=\"my app\"",
+		"ONBUILD RUN date",
+		"STOPSIGNAL SIGTERM",
+		"STOPSIGNAL 9",
+		"STOPSIGNAL SIGRTMIN+3",
+		"USER www-data:www-data",
+		"VOLUME /test1 /test2",
+		`VOLUME ["/data"]`,
+		"WORKDIR /var/www",
+	}
+	for _, c := range good {
+		if err := validateChange(c); err != nil {
+			t.Fatalf("%q should be valid: %s", c, err)
+		}
+	}
+
+	bad := []string{
+		"",
+		"CMD",
+		"RUN apt-get update",
+		"HEALTHCHECK CMD true",
+		"MAINTAINER me",
+		"CMD [nginx]",
+		"ENTRYPOINT [\"/bin/sh\", 1]",
+		"ENV HOSTNAME",
+		"ENV 1FOO=bar",
+		"ENV FOO=bar BAZ",
+		"EXPOSE abc",
+		"EXPOSE 0",
+		"EXPOSE 70000",
+		"EXPOSE 80/http",
+		"LABEL version",
+		"LABEL =1.0",
+		"LABEL description=\"unterminated",
+		"ONBUILD ONBUILD RUN date",
+		"STOPSIGNAL 99",
+		"STOPSIGNAL sig term",
+		"USER www-data root",
+		"WORKDIR /a /b",
+	}
+	for _, c := range bad {
+		if err := validateChange(c); err == nil {
+			t.Fatalf("%q should be invalid", c)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	words, err := splitWords(`a  "b c" d='e f'` + "\tg")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"a", "b c", "d=e f", "g"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Fatalf("bad: %#v", words)
+	}
+}
+
+func TestSplitWords_escapes(t *testing.T) {
+	cases := map[string][]string{
+		`a\ b c`:            {"a b", "c"},
+		`"say \"hi\""`:      {`say "hi"`},
+		`"\$HOME" '\$HOME'`: {"$HOME", `\$HOME`},
+		`"c:\x" c:\\x`:      {`c:\x`, `c:\x`},
+		`'it'\''s' "a'b"`:   {"it's", "a'b"},
+		`trailing\`:         {`trailing\`},
+		`x="\\" y=\"`:       {`x=\`, `y="`},
+	}
+
+	for in, expected := range cases {
+		words, err := splitWords(in)
+		if err != nil {
+			t.Fatalf("%s: err: %s", in, err)
+		}
+		if !reflect.DeepEqual(words, expected) {
+			t.Fatalf("%s: bad: %#v", in, words)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package podman
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// cleanupProfile is a set of paths removed from the container before it is
+// committed or exported, after running a command tidying them up.
+type cleanupProfile struct {
+	// Command is run if the tool it uses is installed, like `dnf clean all`.
+	Command string
+	Paths   []string
+}
+
+// cleanupProfiles are the profiles of the cleanup_profiles option.
+var cleanupProfiles = map[string]cleanupProfile{
+	"apk": {
+		Paths: []string{"/var/cache/apk/*"},
+	},
+	"apt": {
+		Command: "apt-get clean",
+		Paths:   []string{"/var/lib/apt/lists/*", "/var/cache/apt/*.bin"},
+	},
+	"dnf": {
+		Command: "dnf clean all",
+		Paths:   []string{"/var/cache/dnf/*", "/var/cache/yum/*"},
+	},
+	"history": {
+		Paths: []string{"/root/.*_history", "/home/*/.*_history"},
+	},
+	"pip": {
+		Paths: []string{"/root/.cache/pip", "/home/*/.cache/pip"},
+	},
+	"tmp": {
+		Paths: []string{"/tmp/*", "/var/tmp/*"},
+	},
+}
+
+// cleanupProfileNames returns the names of the cleanup profiles, sorted.
+func cleanupProfileNames() []string {
+	names := make([]string, 0, len(cleanupProfiles))
+	for name := range cleanupProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cleanupPaths returns the globs removed by the cleanup_paths and
+// cleanup_profiles options.
+func cleanupPaths(config *Config) []string {
+	paths := slices.Clone(config.CleanupPaths)
+	for _, name := range config.CleanupProfiles {
+		paths = append(paths, cleanupProfiles[name].Paths...)
+	}
+	return paths
+}
+
+// exportFilter returns the filter of the paths left out of the export.
+func exportFilter(config *Config) pathFilter {
+	return append(pathFilter(slices.Clone(config.ExportExcludes)), cleanupPaths(config)...)
+}
+
+// cleanupScript returns the shell script running the commands of the profiles
+// and removing the paths.
+func cleanupScript(config *Config) string {
+	var lines []string
+	for _, name := range config.CleanupProfiles {
+		command := cleanupProfiles[name].Command
+		if command == "" {
+			continue
+		}
+		tool := strings.Fields(command)[0]
+		lines = append(lines, fmt.Sprintf("if command -v %s >/dev/null 2>&1; then %s; fi", tool, command))
+	}
+
+	paths := cleanupPaths(config)
+	if len(paths) > 0 {
+		globs := make([]string, len(paths))
+		for i, p := range paths {
+			globs[i] = shellGlob(p)
+		}
+		lines = append(lines, "rm -rf -- "+strings.Join(globs, " "))
+	}
+
+	return strings.Join(lines, " && ")
+}
+
+// shellGlob escapes everything but the glob characters of a path, so that the
+// shell only expands the glob.
+func shellGlob(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		switch {
+		case strings.ContainsRune("*?[]", r),
+			r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			strings.ContainsRune("/._-+,:@%", r):
+		default:
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// pathFilter matches the paths of the container against globs, like
+// /var/cache/*. A path matches if it, or one of its parents, matches one of
+// the globs. Unlike the shell, * also matches names starting with a dot.
+type pathFilter []string
+
+func (f pathFilter) Match(name string) bool {
+	for p := name; p != "/"; p = path.Dir(p) {
+		for _, glob := range f {
+			if ok, _ := path.Match(glob, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validGlob returns true if the glob is a valid absolute path glob.
+func validGlob(glob string) bool {
+	_, err := path.Match(glob, "/")
+	return err == nil && strings.HasPrefix(glob, "/")
+}
+
+// filterTar copies the tar stream read from r to w, without the entries
+// matching the filter, nor the hard links to them.
+func filterTar(w io.Writer, r io.Reader, filter pathFilter) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading export: %s", err) //nolint:staticcheck
+		}
+
+		if filter.Match(containerPath(hdr.Name)) {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink && filter.Match(containerPath(hdr.Linkname)) {
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// exportFiltered exports the container to dst, without the paths matching
+// the filter.
+func exportFiltered(driver Driver, containerId string, dst io.Writer, filter pathFilter) error {
+	if len(filter) == 0 {
+		return driver.Export(containerId, dst)
+	}
+
+	return streamExport(driver, containerId, func(r io.Reader) error {
+		return filterTar(dst, r, filter)
+	})
+}
+
+// streamExport exports the container to read, which is run while the export
+// is going on, rather than going through a tar file as large as the
+// filesystem of the container. The export fails if read does.
+func streamExport(driver Driver, containerId string, read func(r io.Reader) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := read(pr)
+		if err == nil {
+			// Read the padding after the end of the archive
+			_, err = io.Copy(io.Discard, pr)
+		}
+		// Make the export fail too if reading failed
+		pr.CloseWithError(err) //nolint:errcheck
+		done <- err
+	}()
+
+	exportErr := driver.Export(containerId, pw)
+	pw.CloseWithError(exportErr) //nolint:errcheck
+	if err := <-done; err != nil {
+		return err
+	}
+	return exportErr
+}
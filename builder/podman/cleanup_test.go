@@ -0,0 +1,108 @@
+package podman
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestCleanupScript(t *testing.T) {
+	config := &Config{}
+	if script := cleanupScript(config); script != "" {
+		t.Fatalf("bad: %q", script)
+	}
+
+	config.CleanupProfiles = []string{"dnf", "apk"}
+	config.CleanupPaths = []string{"/var/log/*.log", "/srv/my data"}
+	expected := "if command -v dnf >/dev/null 2>&1; then dnf clean all; fi && " +
+		`rm -rf -- /var/log/*.log /srv/my\ data /var/cache/dnf/* /var/cache/yum/* /var/cache/apk/*`
+	if script := cleanupScript(config); script != expected {
+		t.Fatalf("bad: %q", script)
+	}
+}
+
+func TestShellGlob(t *testing.T) {
+	cases := map[string]string{
+		"/tmp/*":             "/tmp/*",
+		"/home/*/.cache/pi?": "/home/*/.cache/pi?",
+		"/var/[ab]":          "/var/[ab]",
+		"/srv/$(reboot)":     `/srv/\$\(reboot\)`,
+		"/srv/it's":          `/srv/it\'s`,
+	}
+	for p, expected := range cases {
+		if actual := shellGlob(p); actual != expected {
+			t.Fatalf("%s: bad: %s", p, actual)
+		}
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	filter := pathFilter{"/var/cache/*", "/root/.*_history"}
+	cases := map[string]bool{
+		"/var/cache/dnf":          true,
+		"/var/cache/dnf/packages": true,
+		"/var/cache/.hidden":      true,
+		"/var/cache":              false,
+		"/root/.bash_history":     true,
+		"/root/.bashrc":           false,
+		"/etc":                    false,
+	}
+	for name, expected := range cases {
+		if actual := filter.Match(name); actual != expected {
+			t.Fatalf("%s: bad: %t", name, actual)
+		}
+	}
+}
+
+func TestFilterTar(t *testing.T) {
+	var buf bytes.Buffer
+	if err := filterTar(&buf, testTar(t), pathFilter{"/var/cache/*", "/run"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	expected := []string{
+		"./", "etc/", "etc/hostname", "etc/hostname.link", "etc/localtime",
+		"readonly/", "readonly/file", "usr/bin/tool", "../../escape",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bad: %#v", names)
+	}
+}
+
+func TestExportFiltered(t *testing.T) {
+	driver := &MockDriver{ExportReader: testTar(t)}
+	var buf bytes.Buffer
+	if err := exportFiltered(driver, "foo", &buf, pathFilter{"/etc"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("web\n")) {
+		t.Fatal("excluded file shouldn't be exported")
+	}
+
+	// A broken export fails the filtering too
+	driver = &MockDriver{ExportReader: bytes.NewBufferString("not a tar")}
+	if err := exportFiltered(driver, "foo", io.Discard, pathFilter{"/etc"}); err == nil {
+		t.Fatal("should error")
+	}
+
+	driver = &MockDriver{ExportError: errors.New("export failed")}
+	if err := exportFiltered(driver, "foo", io.Discard, pathFilter{"/etc"}); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,69 @@
+package podman
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressionLevels are the ranges of the levels of each export_compression.
+var compressionLevels = map[string][2]int{
+	"gzip": {1, 9},
+	"zstd": {1, 22},
+	"xz":   {1, 9},
+}
+
+// xzDictCaps are the dictionary sizes of the xz presets, by level.
+var xzDictCaps = []int{0, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// validateCompression checks the export_compression and
+// export_compression_level options. A level of 0 is the default level.
+func validateCompression(compression string, level int) error {
+	if compression == "none" {
+		if level != 0 {
+			return fmt.Errorf("export_compression_level requires export_compression")
+		}
+		return nil
+	}
+
+	levels, ok := compressionLevels[compression]
+	if !ok {
+		return fmt.Errorf("export_compression must be one of none, gzip, zstd, xz, got %q", compression)
+	}
+	if level != 0 && (level < levels[0] || level > levels[1]) {
+		return fmt.Errorf("export_compression_level must be between %d and %d for %s, got %d",
+			levels[0], levels[1], compression, level)
+	}
+
+	return nil
+}
+
+// compressWriter returns a writer compressing to w. It must be closed to
+// flush the compressed data, which doesn't close w.
+func compressWriter(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	switch compression {
+	case "gzip":
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case "zstd":
+		if level == 0 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	case "xz":
+		return xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(w)
+	}
+
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,80 @@
+package podman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestCompressWriter(t *testing.T) {
+	data := strings.Repeat("packer ", 1000)
+
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"none": func(r io.Reader) (io.Reader, error) { return r, nil },
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		"xz":   func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) },
+	}
+
+	for compression, newReader := range readers {
+		for _, level := range []int{0, 1, 9} {
+			var buf bytes.Buffer
+			w, err := compressWriter(&buf, compression, level)
+			if err != nil {
+				t.Fatalf("%s %d: %s", compression, level, err)
+			}
+			if _, err := io.WriteString(w, data); err != nil {
+				t.Fatalf("%s %d: %s", compression, level, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%s %d: %s", compression, level, err)
+			}
+
+			r, err := newReader(&buf)
+			if err != nil {
+				t.Fatalf("%s %d: %s", compression, level, err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s %d: %s", compression, level, err)
+			}
+			if string(out) != data {
+				t.Fatalf("%s %d: bad data", compression, level)
+			}
+		}
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	valid := map[string][]int{
+		"none": {0},
+		"gzip": {0, 1, 9},
+		"zstd": {0, 1, 22},
+		"xz":   {0, 1, 9},
+	}
+	for compression, levels := range valid {
+		for _, level := range levels {
+			if err := validateCompression(compression, level); err != nil {
+				t.Fatalf("%s %d: %s", compression, level, err)
+			}
+		}
+	}
+
+	invalid := map[string]int{
+		"none": 1,
+		"gzip": 10,
+		"zstd": 23,
+		"xz":   -1,
+		"bz2":  0,
+	}
+	for compression, level := range invalid {
+		if err := validateCompression(compression, level); err == nil {
+			t.Fatalf("%s %d should be invalid", compression, level)
+		}
+	}
+}
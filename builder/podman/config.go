@@ -1,11 +1,17 @@
 //go:generate packer-sdc struct-markdown
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,MountConfig
 
 package podman
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
@@ -21,6 +27,25 @@ var (
 	errArtifactUseConflict = fmt.Errorf("Cannot specify more than one of commit, discard, and export_path")
 	errExportPathNotFile   = fmt.Errorf("export_path must be a file, not a directory")
 	errImageNotSpecified   = fmt.Errorf("Image must be specified")
+	errSquashNotCommit     = fmt.Errorf("squash can only be used with commit")
+	errFormatNotCommit     = fmt.Errorf("format can only be used with commit")
+	errFormatSquashAll     = fmt.Errorf("format docker can't be used with squash all")
+	errNoReadyCommand      = fmt.Errorf("ready_command must be specified with the command ready_check")
+	errStopAndPause        = fmt.Errorf("stop_before_commit and pause_before_commit can't be used together")
+	errCompressNoExport    = fmt.Errorf("export_compression can only be used with export_path")
+	errCompressNotTar      = fmt.Errorf("export_compression can only be used with the tar export_format")
+	errExportPathNotDir    = fmt.Errorf("export_path must be a directory with the directory export_format")
+	errDiskLabelTooLong    = fmt.Errorf("export_disk_label can't be longer than 16 characters")
+	errDiskNotDiskFormat   = fmt.Errorf("export_disk_size and export_disk_label can only be used with the ext4, raw and qcow2 export_format")
+	errHelperNoLogin       = fmt.Errorf("login_credential_helper requires login and login_server")
+	errHelperAndPassword   = fmt.Errorf("login_credential_helper can't be used with login_username and login_password")
+)
+
+var (
+	// containerNameRegexp matches the container names accepted by podman.
+	containerNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	// containerNameInvalid matches the characters not allowed in them.
+	containerNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
 )
 
 // Config for packer arguments. Shamelessly taken from packer-plugin-docker with
@@ -33,15 +58,34 @@ type Config struct {
 	Author string `mapstructure:"author"`
 	// Podmanfile instructions to add to the commit. Example of instructions
 	// are CMD, ENTRYPOINT, ENV, and EXPOSE. Example: [ "USER ubuntu", "WORKDIR
-	// /app", "EXPOSE 8080" ]
+	// /app", "EXPOSE 8080" ]. The supported instructions are CMD, ENTRYPOINT,
+	// ENV, EXPOSE, LABEL, ONBUILD, STOPSIGNAL, USER, VOLUME and WORKDIR; they
+	// are validated before the build starts.
 	Changes []string `mapstructure:"changes"`
 	// If true, the container will be committed to an image rather than exported.
 	Commit bool `mapstructure:"commit" required:"true"`
 
+	// The name of the build container. Template functions like
+	// `{{build_name}}` and `{{timestamp}}` can be used. Defaults to
+	// `packer-<build name>-<timestamp>`, with the characters not allowed in
+	// container names replaced by `-`.
+	ContainerName string `mapstructure:"container_name" required:"false"`
+	// If true, a container with the same name as the build container is
+	// removed when the build starts, like one left behind by an earlier
+	// build. Otherwise the build fails. Defaults to false.
+	ReplaceContainer bool `mapstructure:"replace_container" required:"false"`
 	// The directory inside container to mount temp directory from host server
 	// for work [file provisioner](/docs/provisioners/file). This defaults
-	// to c:/packer-files on windows and /packer-files on other systems.
+	// to c:/packer-files on windows and /packer-files on other systems. The
+	// directory is removed before the container is committed or exported,
+	// unless the image has it.
 	ContainerDir string `mapstructure:"container_dir" required:"false"`
+	// Additional `--mount` options for the temp directory mounted at
+	// `container_dir`, for example `["relabel=shared"]`. When the host runs
+	// SELinux in enforcing mode and no `relabel=` option is given, the
+	// directory is relabeled with `relabel=private` so that the container can
+	// access it.
+	ContainerDirMountOptions []string `mapstructure:"container_dir_mount_options" required:"false"`
 	// An array of devices which will be accessible in container when it's run
 	// without `--privileged` flag.
 	Device []string `mapstructure:"device" required:"false"`
@@ -61,13 +105,66 @@ type Config struct {
 	// name/ID if you want: (UID or UID:GID). You may need this if you get
 	// permission errors trying to run the shell or other provisioners.
 	ExecUser string `mapstructure:"exec_user" required:"false"`
-	// The path where the final container will be exported as a tar file.
+	// The path where the final container will be exported as a tar file, or
+	// as a directory or a disk image depending on `export_format`.
 	ExportPath string `mapstructure:"export_path" required:"true"`
+	// What to export the container to: `tar` (the default), a tar file at
+	// `export_path`, `directory`, the root filesystem of the container
+	// unpacked to the `export_path` directory, or a disk image holding the
+	// root filesystem in an ext4 filesystem: `ext4`, the bare filesystem,
+	// `raw`, a disk with an MBR partition table and a single bootable
+	// partition, or `qcow2`, the same disk in the qcow2 format. No bootloader
+	// is installed. Disk images require running Packer as root, `mkfs.ext4`,
+	// and `qemu-img` for `qcow2`. The ownership of the files, their extended
+	// attributes and the device nodes of a `directory` are only preserved
+	// when Packer runs as root. An existing directory is only replaced with
+	// `-force`.
+	ExportFormat string `mapstructure:"export_format" required:"false"`
+	// The size of the filesystem of the `ext4`, `raw` and `qcow2` export
+	// formats, like `4G` or `512M`. Defaults to one and a half times the
+	// size of the files, plus 128M.
+	ExportDiskSize string `mapstructure:"export_disk_size" required:"false"`
+	// The label of the filesystem of the `ext4`, `raw` and `qcow2` export
+	// formats, up to 16 characters. Defaults to `rootfs`.
+	ExportDiskLabel string `mapstructure:"export_disk_label" required:"false"`
+	// Globs of the paths in the container that aren't exported, along with
+	// their content, for example `["/var/cache/*", "/tmp/*"]`. Unlike in the
+	// shell, `*` also matches names starting with a dot.
+	ExportExcludes []string `mapstructure:"export_excludes" required:"false"`
+	// How to compress the exported tar file: `none` (the default), `gzip`,
+	// `zstd` or `xz`. The file at `export_path` is written as a whole once
+	// the export succeeded, along with a `<export_path>.sha256` file holding
+	// its SHA-256 checksum, in the format of `sha256sum`.
+	ExportCompression string `mapstructure:"export_compression" required:"false"`
+	// The compression level, from 1 to 9 for `gzip` and `xz`, and from 1 to 22
+	// for `zstd`. Defaults to the default level of each compression.
+	ExportCompressionLevel int `mapstructure:"export_compression_level" required:"false"`
 	// The base image for the Podman container that will be started. This image
 	// will be pulled from the Podman registry if it doesn't already exist.
 	Image string `mapstructure:"image" required:"true"`
+	// Labels set on the build container and on the committed image, for
+	// example `org.opencontainers.image.source`. The container and image
+	// are always labeled with the Packer build name, run UUID and plugin
+	// version, and the image with the `org.opencontainers.image.created`
+	// and `org.opencontainers.image.base.name` annotations, which these
+	// labels can override.
+	Labels map[string]string `mapstructure:"labels" required:"false"`
 	// Set a message for the commit.
 	Message string `mapstructure:"message" required:"true"`
+	// How to squash the layers of the committed image. `none` (the default)
+	// adds a single layer with the changes made during the build on top of
+	// the base image. `new` squashes the new layers into a single one using
+	// `podman commit --squash`. `all` flattens the whole image into a single
+	// layer by exporting and re-importing the container; only the `changes`
+	// (including the CMD and ENTRYPOINT carried over from the base image) are
+	// kept from the image configuration, and `author` and `message` are
+	// ignored. Only valid with `commit`.
+	Squash string `mapstructure:"squash" required:"false"`
+	// The format of the committed image, `oci` (the default) or `docker`.
+	// The OCI format doesn't support the ONBUILD instruction, a warning is
+	// printed when it is used in `changes` with this format. Only valid with
+	// `commit`, and can't be `docker` when `squash` is `all`.
+	Format string `mapstructure:"format" required:"false"`
 	// If true, run the Podman container with the `--privileged` flag. This
 	// defaults to false if not set.
 	Privileged bool `mapstructure:"privileged" required:"false"`
@@ -76,34 +173,122 @@ type Config struct {
 	// to use. Otherwise, it is assumed the image already exists and can be
 	// used. This defaults to true if not set.
 	Pull bool `mapstructure:"pull" required:"false"`
+	// When the image is pulled: `always` (the default) pulls it on every
+	// build, `missing` only if there is no local image, `newer` only if the
+	// image in the registry has another digest than the local one, and
+	// `never` uses the local image, failing if it is missing. Ignored when
+	// `pull` is false.
+	PullPolicy string `mapstructure:"pull_policy" required:"false"`
 	// An array of arguments to pass to podman run in order to run the
 	// container. By default this is set to `["-d", "-i", "-t",
 	// "--entrypoint=/bin/sh", "--", "{{.Image}}"]` if you are using a linux
 	// container, and `["-d", "-i", "-t", "--entrypoint=powershell", "--",
 	// "{{.Image}}"]` if you are running a windows container. `{{.Image}}` is a
-	// template variable that corresponds to the image template option. Passing
-	// the entrypoint option this way will make it the default entrypoint of
-	// the resulting image, so running podman run -it --rm  will start the
-	// podman image from the /bin/sh shell interpreter; you could run a script
-	// or another shell by running podman run -it --rm  -c /bin/bash. If your
-	// podman image embeds a binary intended to be run often, you should
-	// consider changing the default entrypoint to point to it.
+	// template variable that corresponds to the image template option. The
+	// entrypoint, command and user set this way only apply to the build
+	// container: when committing, the ones of the base image are restored
+	// unless they are set in `changes`. See below for the rest of the
+	// configuration it sets.
 	RunCommand []string `mapstructure:"run_command" required:"false"`
 	// An array of additional tmpfs volumes to mount into this container.
 	TmpFs []string `mapstructure:"tmpfs" required:"false"`
-	// A mapping of additional volumes to mount into this container. The key of
-	// the object is the host path, the value is the container path.
+	// Additional mounts to add to this container, passed to `podman run` as
+	// `--mount` flags in the order they are declared. See the mount
+	// configuration section below for the options of each `mount` block.
+	// Example:
+	//
+	// ```hcl
+	// mount {
+	//   source      = "/srv/cache"
+	//   destination = "/var/cache/build"
+	//   relabel     = "private"
+	// }
+	//
+	// mount {
+	//   type        = "tmpfs"
+	//   destination = "/run/secrets"
+	//   options     = ["tmpfs-size=16m"]
+	// }
+	// ```
+	Mounts []MountConfig `mapstructure:"mount" required:"false"`
+	// Deprecated, use `mount` blocks instead. A mapping of additional volumes
+	// to mount into this container. The key of the object is the host path,
+	// the value is the container path. Each of them is added as a bind mount
+	// after the `mount` blocks.
 	Volumes map[string]string `mapstructure:"volumes" required:"false"`
 	// If true, files uploaded to the container will be owned by the user the
 	// container is running as. If false, the owner will depend on the version
 	// of podman installed in the system. Defaults to true.
 	FixUploadOwner bool `mapstructure:"fix_upload_owner" required:"false"`
+	// The file where the logs of the build container are written when the
+	// build fails. By default they are printed along with the rest of the
+	// build output. The state of the container, including its exit code and
+	// whether it was killed for running out of memory, is always printed.
+	ContainerLogsPath string `mapstructure:"container_logs_path" required:"false"`
+	// If true, the build container and its temp dir are left in place when
+	// the build fails, and the command to inspect the container is printed.
+	// The container is also kept when Packer is run with `-on-error=abort`,
+	// or when choosing to abort with `-on-error=ask`. Defaults to false.
+	KeepContainer bool `mapstructure:"keep_container" required:"false"`
+	// If true, the containers left behind by earlier builds that crashed or
+	// were killed are removed before the build starts. Otherwise they are
+	// only reported. Containers kept with `keep_container` are left behind
+	// too, and are removed as well. Defaults to false.
+	CleanupOrphans bool `mapstructure:"cleanup_orphans" required:"false"`
+	// If true, the container is stopped before it is committed or exported,
+	// so that running processes, like systemd services or package managers,
+	// flush their writes and release their locks. The container is sent
+	// `stop_signal`, and killed if it is still running after
+	// `stop_timeout`. Don't use it with a `run_command` having `--rm`.
+	// Defaults to false.
+	StopBeforeCommit bool `mapstructure:"stop_before_commit" required:"false"`
+	// The signal sent to stop the container with `stop_before_commit`, for
+	// example `SIGINT` or `SIGRTMIN+3`. Defaults to the stop signal of the
+	// container, usually `SIGTERM`.
+	StopSignal string `mapstructure:"stop_signal" required:"false"`
+	// How long to wait for the container to stop with `stop_before_commit`
+	// before killing it. Defaults to `10s`.
+	StopTimeout time.Duration `mapstructure:"stop_timeout" required:"false"`
+	// If true, the container is paused with `podman pause` while it is
+	// committed or exported, and resumed afterwards. Unlike
+	// `stop_before_commit`, the processes don't get a chance to finish their
+	// writes, but aren't restarted either. Pausing rootless containers
+	// requires cgroups v2. Defaults to false.
+	PauseBeforeCommit bool `mapstructure:"pause_before_commit" required:"false"`
+	// Globs of the paths removed from the container, along with their
+	// content, before it is committed or exported, for example
+	// `["/var/log/*.log", "/root/.ssh"]`. They're removed through the
+	// communicator by the shell, whose globs don't match names starting with
+	// a dot, and are also left out of the exported or squashed filesystem.
+	CleanupPaths []string `mapstructure:"cleanup_paths" required:"false"`
+	// Built-in sets of paths removed like `cleanup_paths`: `apt`, `dnf`,
+	// `apk` and `pip` remove the caches of these package managers, running
+	// `apt-get clean` and `dnf clean all` first when they're installed, `tmp`
+	// empties `/tmp` and `/var/tmp`, and `history` removes the shell
+	// histories of root and the users in `/home`.
+	CleanupProfiles []string `mapstructure:"cleanup_profiles" required:"false"`
 	// Enforce Podman in running in systemd mode. By default this value is set
 	// to `true`, but it can be `false` or `always`.
 	// Please refer to Podman documentation for additional details
 	Systemd string `mapstructure:"systemd" required:"false"`
+	// Wait for the container to be ready before running the provisioners.
+	// One of `healthcheck`, to wait for the healthcheck of the image to pass,
+	// `command`, to wait for `ready_command` to exit with a zero status, or
+	// `systemd`, to wait for `systemctl is-system-running` to report that the
+	// system booted. Defaults to `command` when `ready_command` is set, and
+	// to not waiting otherwise.
+	ReadyCheck string `mapstructure:"ready_check" required:"false"`
+	// The command run inside the container with `/bin/sh -c` by the
+	// `command` ready check.
+	ReadyCommand string `mapstructure:"ready_command" required:"false"`
+	// How long to wait for the container to be ready, for example `90s` or
+	// `10m`. A check still running when it expires is killed. Defaults to
+	// `5m`.
+	ReadyTimeout time.Duration `mapstructure:"ready_timeout" required:"false"`
 
 	// This is used to login to private registry to pull a base container.
+	// The credentials are stored in an auth file private to the build, and
+	// never in the auth file of the user.
 	Login bool `mapstructure:"login" required:"false"`
 	// The password to use to authenticate to login.
 	LoginPassword string `mapstructure:"login_password" required:"false"`
@@ -111,10 +296,127 @@ type Config struct {
 	LoginServer string `mapstructure:"login_server" required:"false"`
 	// The username to use to authenticate to login.
 	LoginUsername string `mapstructure:"login_username" required:"false"`
+	// A credential helper of Docker that the credentials of `login_server`
+	// are got from, instead of `login_username` and `login_password`, for
+	// short-lived registry tokens. It is the name of the helper without the
+	// `docker-credential-` prefix, like `ecr-login` for Amazon ECR or `gcr`
+	// for Google registries, or the path of the helper.
+	LoginCredentialHelper string `mapstructure:"login_credential_helper" required:"false"`
+	// If true, the TLS certificate of `login_server` isn't verified when
+	// logging in, like for a registry with a self-signed certificate.
+	// Defaults to false.
+	LoginSkipTLSVerify bool `mapstructure:"login_skip_tls_verify" required:"false"`
+	// A directory of certificates (`*.crt`), client certificates (`*.cert`)
+	// and keys (`*.key`) used to connect to `login_server`, instead of the
+	// one in `/etc/containers/certs.d`.
+	LoginCertDir string `mapstructure:"login_cert_dir" required:"false"`
+	// The path of an auth file, in the format of `containers-auth.json`,
+	// holding the credentials used to pull the base image. It is copied to
+	// an auth file private to the build, which `login` adds its credentials
+	// to, so that it is never modified.
+	AuthFile string `mapstructure:"authfile" required:"false"`
 
 	ctx interpolate.Context
 }
 
+// MountConfig describes a single mount added to the build container. It maps
+// to one `--mount` flag of `podman run`.
+type MountConfig struct {
+	// The type of the mount. One of `bind`, `volume`, `tmpfs` or `image`.
+	// Defaults to `bind`.
+	Type string `mapstructure:"type" required:"false"`
+	// The source of the mount: the host path for `bind`, the volume name for
+	// `volume` and the image reference for `image`. Must be empty for
+	// `tmpfs` mounts.
+	Source string `mapstructure:"source" required:"false"`
+	// The path inside the container where the mount is attached.
+	Destination string `mapstructure:"destination" required:"true"`
+	// If true, the mount is read-only inside the container.
+	ReadOnly bool `mapstructure:"read_only" required:"false"`
+	// SELinux relabeling of a `bind` mount. `shared` relabels the content so
+	// that it can be used by several containers (like `:z`), `private` so that
+	// only this container can use it (like `:Z`).
+	Relabel string `mapstructure:"relabel" required:"false"`
+	// Mount propagation of a `bind` mount. One of `private`, `rprivate`,
+	// `shared`, `rshared`, `slave` or `rslave`.
+	Propagation string `mapstructure:"propagation" required:"false"`
+	// Additional options appended verbatim to the `--mount` flag, for example
+	// `["tmpfs-size=64m", "U"]`.
+	Options []string `mapstructure:"options" required:"false"`
+}
+
+var (
+	mountTypes        = []string{"bind", "volume", "tmpfs", "image"}
+	mountRelabels     = []string{"shared", "private"}
+	mountPropagations = []string{"private", "rprivate", "shared", "rshared", "slave", "rslave"}
+)
+
+// Prepare sets the defaults of the mount and validates it.
+func (m *MountConfig) Prepare() []error {
+	var errs []error
+
+	if m.Type == "" {
+		m.Type = "bind"
+	}
+	if !slices.Contains(mountTypes, m.Type) {
+		errs = append(errs, fmt.Errorf("type must be one of %s, got %q",
+			strings.Join(mountTypes, ", "), m.Type))
+	}
+
+	if m.Destination == "" {
+		errs = append(errs, fmt.Errorf("destination must be specified"))
+	}
+
+	if m.Type == "tmpfs" {
+		if m.Source != "" {
+			errs = append(errs, fmt.Errorf("source can't be set on tmpfs mounts"))
+		}
+	} else if m.Source == "" {
+		errs = append(errs, fmt.Errorf("source must be specified on %s mounts", m.Type))
+	}
+
+	if m.Relabel != "" {
+		if m.Type != "bind" {
+			errs = append(errs, fmt.Errorf("relabel can only be set on bind mounts"))
+		} else if !slices.Contains(mountRelabels, m.Relabel) {
+			errs = append(errs, fmt.Errorf("relabel must be one of %s, got %q",
+				strings.Join(mountRelabels, ", "), m.Relabel))
+		}
+	}
+
+	if m.Propagation != "" {
+		if m.Type != "bind" {
+			errs = append(errs, fmt.Errorf("propagation can only be set on bind mounts"))
+		} else if !slices.Contains(mountPropagations, m.Propagation) {
+			errs = append(errs, fmt.Errorf("propagation must be one of %s, got %q",
+				strings.Join(mountPropagations, ", "), m.Propagation))
+		}
+	}
+
+	return errs
+}
+
+// String renders the mount as the value of a `podman run --mount` flag.
+func (m MountConfig) String() string {
+	opts := []string{"type=" + m.Type}
+	if m.Source != "" {
+		opts = append(opts, "source="+m.Source)
+	}
+	opts = append(opts, "destination="+m.Destination)
+	if m.ReadOnly {
+		opts = append(opts, "ro=true")
+	}
+	if m.Relabel != "" {
+		opts = append(opts, "relabel="+m.Relabel)
+	}
+	if m.Propagation != "" {
+		opts = append(opts, "bind-propagation="+m.Propagation)
+	}
+	opts = append(opts, m.Options...)
+
+	return strings.Join(opts, ",")
+}
+
 func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	c.FixUploadOwner = true
 	// Systemd accepts three value, so we have to treat it as a string
@@ -154,6 +456,10 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.Pull = true
 	}
 
+	if c.PullPolicy == "" {
+		c.PullPolicy = "always"
+	}
+
 	// Default to the normal Podman type
 	if c.Comm.Type == "" {
 		// Note: if we don't put "docker" here, packer SDK will get very angry
@@ -170,6 +476,28 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		errs = packersdk.MultiErrorAppend(errs, errImageNotSpecified)
 	}
 
+	// Keep the password out of the logs
+	packersdk.LogSecretFilter.Set(c.LoginPassword)
+
+	if c.LoginCredentialHelper != "" {
+		if !c.Login || c.LoginServer == "" {
+			errs = packersdk.MultiErrorAppend(errs, errHelperNoLogin)
+		}
+		if c.LoginUsername != "" || c.LoginPassword != "" {
+			errs = packersdk.MultiErrorAppend(errs, errHelperAndPassword)
+		}
+	}
+	if c.AuthFile != "" {
+		if _, err := os.Stat(c.AuthFile); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("authfile: %s", err))
+		}
+	}
+
+	if !slices.Contains([]string{"always", "missing", "newer", "never"}, c.PullPolicy) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+			"pull_policy must be one of always, missing, newer, never, got %q", c.PullPolicy))
+	}
+
 	if (c.ExportPath != "" && c.Commit) || (c.ExportPath != "" && c.Discard) || (c.Commit && c.Discard) {
 		errs = packersdk.MultiErrorAppend(errs, errArtifactUseConflict)
 	}
@@ -178,10 +506,164 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		errs = packersdk.MultiErrorAppend(errs, errArtifactNotUsed)
 	}
 
-	if c.ExportPath != "" {
+	if c.ExportFormat == "" {
+		c.ExportFormat = "tar"
+	}
+	switch c.ExportFormat {
+	case "tar":
+		if c.ExportPath != "" {
+			if fi, err := os.Stat(c.ExportPath); err == nil && fi.IsDir() {
+				errs = packersdk.MultiErrorAppend(errs, errExportPathNotFile)
+			}
+		}
+	case "directory":
+		if fi, err := os.Stat(c.ExportPath); err == nil && !fi.IsDir() {
+			errs = packersdk.MultiErrorAppend(errs, errExportPathNotDir)
+		}
+	case "ext4", "raw", "qcow2":
 		if fi, err := os.Stat(c.ExportPath); err == nil && fi.IsDir() {
 			errs = packersdk.MultiErrorAppend(errs, errExportPathNotFile)
 		}
+		if err := checkDiskTools(c.ExportFormat); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+			"export_format must be one of tar, directory, ext4, raw, qcow2, got %q", c.ExportFormat))
+	}
+	if c.ExportFormat != "tar" && c.ExportCompression != "" && c.ExportCompression != "none" {
+		errs = packersdk.MultiErrorAppend(errs, errCompressNotTar)
+	}
+	if c.ExportDiskSize != "" {
+		if _, err := parseSize(c.ExportDiskSize); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("export_disk_size: %s", err))
+		}
+	}
+	if c.ExportDiskLabel == "" {
+		c.ExportDiskLabel = "rootfs"
+	} else if len(c.ExportDiskLabel) > 16 {
+		errs = packersdk.MultiErrorAppend(errs, errDiskLabelTooLong)
+	}
+	if (c.ExportDiskSize != "" || c.ExportDiskLabel != "rootfs") && !slices.Contains(diskFormats, c.ExportFormat) {
+		errs = packersdk.MultiErrorAppend(errs, errDiskNotDiskFormat)
+	}
+	for _, glob := range c.ExportExcludes {
+		if !validGlob(glob) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+				"export_excludes: %q must be an absolute path glob", glob))
+		}
+	}
+	for _, glob := range c.CleanupPaths {
+		if !validGlob(glob) || path.Clean(glob) == "/" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+				"cleanup_paths: %q must be an absolute path glob", glob))
+		}
+	}
+	for _, name := range c.CleanupProfiles {
+		if _, ok := cleanupProfiles[name]; !ok {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+				"cleanup_profiles: %q must be one of %s", name, strings.Join(cleanupProfileNames(), ", ")))
+		}
+	}
+
+	if c.ExportCompression == "" {
+		c.ExportCompression = "none"
+	}
+	if c.ExportCompression != "none" && c.ExportPath == "" {
+		errs = packersdk.MultiErrorAppend(errs, errCompressNoExport)
+	} else if err := validateCompression(c.ExportCompression, c.ExportCompressionLevel); err != nil {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
+	switch c.Squash {
+	case "":
+		c.Squash = "none"
+	case "none", "new", "all":
+	default:
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("squash must be one of none, new, all, got %q", c.Squash))
+	}
+	if c.Squash != "none" && !c.Commit {
+		errs = packersdk.MultiErrorAppend(errs, errSquashNotCommit)
+	}
+
+	switch c.Format {
+	case "":
+		c.Format = "oci"
+	case "oci", "docker":
+	default:
+		errs = packersdk.MultiErrorAppend(errs,
+			fmt.Errorf("format must be one of oci, docker, got %q", c.Format))
+	}
+	if c.Format != "oci" && !c.Commit {
+		errs = packersdk.MultiErrorAppend(errs, errFormatNotCommit)
+	}
+	if c.Format == "docker" && c.Squash == "all" {
+		errs = packersdk.MultiErrorAppend(errs, errFormatSquashAll)
+	}
+
+	var warnings []string
+	for _, change := range c.Changes {
+		if err := validateChange(change); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("change %q: %s", change, err))
+			continue
+		}
+		if c.Commit && c.Format == "oci" &&
+			slices.Contains(dockerOnlyInstructions, parseChange(change).Instruction) {
+			warnings = append(warnings, fmt.Sprintf(
+				"change %q is only supported by the docker format and will be ignored by the oci format", change))
+		}
+	}
+
+	if c.ReadyCheck == "" && c.ReadyCommand != "" {
+		c.ReadyCheck = "command"
+	}
+	switch c.ReadyCheck {
+	case "", "healthcheck", "systemd":
+	case "command":
+		if c.ReadyCommand == "" {
+			errs = packersdk.MultiErrorAppend(errs, errNoReadyCommand)
+		}
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+			"ready_check must be one of healthcheck, command, systemd, got %q", c.ReadyCheck))
+	}
+	if c.ReadyTimeout == 0 {
+		c.ReadyTimeout = 5 * time.Minute
+	}
+
+	if c.StopBeforeCommit && c.PauseBeforeCommit {
+		errs = packersdk.MultiErrorAppend(errs, errStopAndPause)
+	}
+	if c.StopSignal != "" {
+		if err := validateChange("STOPSIGNAL " + c.StopSignal); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("stop_signal: %s", err))
+		}
+	}
+	if c.StopTimeout == 0 {
+		c.StopTimeout = 10 * time.Second
+	}
+
+	if len(c.Volumes) > 0 {
+		warnings = append(warnings,
+			"volumes is deprecated and will be removed in a future version, use mount blocks instead")
+		for _, host := range slices.Sorted(maps.Keys(c.Volumes)) {
+			c.Mounts = append(c.Mounts, MountConfig{Source: host, Destination: c.Volumes[host]})
+		}
+	}
+
+	for i := range c.Mounts {
+		for _, err := range c.Mounts[i].Prepare() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("mount %d: %s", i, err))
+		}
+	}
+
+	if c.ContainerName == "" {
+		c.ContainerName = defaultContainerName(c.PackerBuildName, time.Now())
+	} else if !containerNameRegexp.MatchString(c.ContainerName) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf(
+			"container_name %q must start with a letter or digit, followed by letters, digits, _, . or -",
+			c.ContainerName))
 	}
 
 	if c.ContainerDir == "" {
@@ -189,8 +671,19 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	}
 
 	if errs != nil && len(errs.Errors) > 0 {
-		return nil, errs
+		return warnings, errs
 	}
 
-	return nil, nil
+	return warnings, nil
+}
+
+// defaultContainerName returns packer-<build name>-<timestamp>, replacing the
+// characters of the build name that podman doesn't allow, like in
+// `podman.fedora:40`.
+func defaultContainerName(buildName string, now time.Time) string {
+	name := "packer-"
+	if buildName != "" {
+		name += containerNameInvalid.ReplaceAllString(buildName, "-") + "-"
+	}
+	return fmt.Sprintf("%s%d", name, now.Unix())
 }
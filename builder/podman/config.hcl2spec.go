@@ -70,27 +70,57 @@ type FlatConfig struct {
 	Author                    *string           `mapstructure:"author" cty:"author" hcl:"author"`
 	Changes                   []string          `mapstructure:"changes" cty:"changes" hcl:"changes"`
 	Commit                    *bool             `mapstructure:"commit" required:"true" cty:"commit" hcl:"commit"`
+	ContainerName             *string           `mapstructure:"container_name" required:"false" cty:"container_name" hcl:"container_name"`
+	ReplaceContainer          *bool             `mapstructure:"replace_container" required:"false" cty:"replace_container" hcl:"replace_container"`
 	ContainerDir              *string           `mapstructure:"container_dir" required:"false" cty:"container_dir" hcl:"container_dir"`
+	ContainerDirMountOptions  []string          `mapstructure:"container_dir_mount_options" required:"false" cty:"container_dir_mount_options" hcl:"container_dir_mount_options"`
 	Device                    []string          `mapstructure:"device" required:"false" cty:"device" hcl:"device"`
 	Discard                   *bool             `mapstructure:"discard" required:"true" cty:"discard" hcl:"discard"`
 	CapAdd                    []string          `mapstructure:"cap_add" required:"false" cty:"cap_add" hcl:"cap_add"`
 	CapDrop                   []string          `mapstructure:"cap_drop" required:"false" cty:"cap_drop" hcl:"cap_drop"`
 	ExecUser                  *string           `mapstructure:"exec_user" required:"false" cty:"exec_user" hcl:"exec_user"`
 	ExportPath                *string           `mapstructure:"export_path" required:"true" cty:"export_path" hcl:"export_path"`
+	ExportFormat              *string           `mapstructure:"export_format" required:"false" cty:"export_format" hcl:"export_format"`
+	ExportDiskSize            *string           `mapstructure:"export_disk_size" required:"false" cty:"export_disk_size" hcl:"export_disk_size"`
+	ExportDiskLabel           *string           `mapstructure:"export_disk_label" required:"false" cty:"export_disk_label" hcl:"export_disk_label"`
+	ExportExcludes            []string          `mapstructure:"export_excludes" required:"false" cty:"export_excludes" hcl:"export_excludes"`
+	ExportCompression         *string           `mapstructure:"export_compression" required:"false" cty:"export_compression" hcl:"export_compression"`
+	ExportCompressionLevel    *int              `mapstructure:"export_compression_level" required:"false" cty:"export_compression_level" hcl:"export_compression_level"`
 	Image                     *string           `mapstructure:"image" required:"true" cty:"image" hcl:"image"`
+	Labels                    map[string]string `mapstructure:"labels" required:"false" cty:"labels" hcl:"labels"`
 	Message                   *string           `mapstructure:"message" required:"true" cty:"message" hcl:"message"`
+	Squash                    *string           `mapstructure:"squash" required:"false" cty:"squash" hcl:"squash"`
+	Format                    *string           `mapstructure:"format" required:"false" cty:"format" hcl:"format"`
 	Privileged                *bool             `mapstructure:"privileged" required:"false" cty:"privileged" hcl:"privileged"`
 	Pty                       *bool             `cty:"pty" hcl:"pty"`
 	Pull                      *bool             `mapstructure:"pull" required:"false" cty:"pull" hcl:"pull"`
+	PullPolicy                *string           `mapstructure:"pull_policy" required:"false" cty:"pull_policy" hcl:"pull_policy"`
 	RunCommand                []string          `mapstructure:"run_command" required:"false" cty:"run_command" hcl:"run_command"`
 	TmpFs                     []string          `mapstructure:"tmpfs" required:"false" cty:"tmpfs" hcl:"tmpfs"`
+	Mounts                    []FlatMountConfig `mapstructure:"mount" required:"false" cty:"mount" hcl:"mount"`
 	Volumes                   map[string]string `mapstructure:"volumes" required:"false" cty:"volumes" hcl:"volumes"`
 	FixUploadOwner            *bool             `mapstructure:"fix_upload_owner" required:"false" cty:"fix_upload_owner" hcl:"fix_upload_owner"`
+	ContainerLogsPath         *string           `mapstructure:"container_logs_path" required:"false" cty:"container_logs_path" hcl:"container_logs_path"`
+	KeepContainer             *bool             `mapstructure:"keep_container" required:"false" cty:"keep_container" hcl:"keep_container"`
+	CleanupOrphans            *bool             `mapstructure:"cleanup_orphans" required:"false" cty:"cleanup_orphans" hcl:"cleanup_orphans"`
+	StopBeforeCommit          *bool             `mapstructure:"stop_before_commit" required:"false" cty:"stop_before_commit" hcl:"stop_before_commit"`
+	StopSignal                *string           `mapstructure:"stop_signal" required:"false" cty:"stop_signal" hcl:"stop_signal"`
+	StopTimeout               *string           `mapstructure:"stop_timeout" required:"false" cty:"stop_timeout" hcl:"stop_timeout"`
+	PauseBeforeCommit         *bool             `mapstructure:"pause_before_commit" required:"false" cty:"pause_before_commit" hcl:"pause_before_commit"`
+	CleanupPaths              []string          `mapstructure:"cleanup_paths" required:"false" cty:"cleanup_paths" hcl:"cleanup_paths"`
+	CleanupProfiles           []string          `mapstructure:"cleanup_profiles" required:"false" cty:"cleanup_profiles" hcl:"cleanup_profiles"`
 	Systemd                   *string           `mapstructure:"systemd" required:"false" cty:"systemd" hcl:"systemd"`
+	ReadyCheck                *string           `mapstructure:"ready_check" required:"false" cty:"ready_check" hcl:"ready_check"`
+	ReadyCommand              *string           `mapstructure:"ready_command" required:"false" cty:"ready_command" hcl:"ready_command"`
+	ReadyTimeout              *string           `mapstructure:"ready_timeout" required:"false" cty:"ready_timeout" hcl:"ready_timeout"`
 	Login                     *bool             `mapstructure:"login" required:"false" cty:"login" hcl:"login"`
 	LoginPassword             *string           `mapstructure:"login_password" required:"false" cty:"login_password" hcl:"login_password"`
 	LoginServer               *string           `mapstructure:"login_server" required:"false" cty:"login_server" hcl:"login_server"`
 	LoginUsername             *string           `mapstructure:"login_username" required:"false" cty:"login_username" hcl:"login_username"`
+	LoginCredentialHelper     *string           `mapstructure:"login_credential_helper" required:"false" cty:"login_credential_helper" hcl:"login_credential_helper"`
+	LoginSkipTLSVerify        *bool             `mapstructure:"login_skip_tls_verify" required:"false" cty:"login_skip_tls_verify" hcl:"login_skip_tls_verify"`
+	LoginCertDir              *string           `mapstructure:"login_cert_dir" required:"false" cty:"login_cert_dir" hcl:"login_cert_dir"`
+	AuthFile                  *string           `mapstructure:"authfile" required:"false" cty:"authfile" hcl:"authfile"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -165,27 +195,92 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"author":                       &hcldec.AttrSpec{Name: "author", Type: cty.String, Required: false},
 		"changes":                      &hcldec.AttrSpec{Name: "changes", Type: cty.List(cty.String), Required: false},
 		"commit":                       &hcldec.AttrSpec{Name: "commit", Type: cty.Bool, Required: false},
+		"container_name":               &hcldec.AttrSpec{Name: "container_name", Type: cty.String, Required: false},
+		"replace_container":            &hcldec.AttrSpec{Name: "replace_container", Type: cty.Bool, Required: false},
 		"container_dir":                &hcldec.AttrSpec{Name: "container_dir", Type: cty.String, Required: false},
+		"container_dir_mount_options":  &hcldec.AttrSpec{Name: "container_dir_mount_options", Type: cty.List(cty.String), Required: false},
 		"device":                       &hcldec.AttrSpec{Name: "device", Type: cty.List(cty.String), Required: false},
 		"discard":                      &hcldec.AttrSpec{Name: "discard", Type: cty.Bool, Required: false},
 		"cap_add":                      &hcldec.AttrSpec{Name: "cap_add", Type: cty.List(cty.String), Required: false},
 		"cap_drop":                     &hcldec.AttrSpec{Name: "cap_drop", Type: cty.List(cty.String), Required: false},
 		"exec_user":                    &hcldec.AttrSpec{Name: "exec_user", Type: cty.String, Required: false},
 		"export_path":                  &hcldec.AttrSpec{Name: "export_path", Type: cty.String, Required: false},
+		"export_format":                &hcldec.AttrSpec{Name: "export_format", Type: cty.String, Required: false},
+		"export_disk_size":             &hcldec.AttrSpec{Name: "export_disk_size", Type: cty.String, Required: false},
+		"export_disk_label":            &hcldec.AttrSpec{Name: "export_disk_label", Type: cty.String, Required: false},
+		"export_excludes":              &hcldec.AttrSpec{Name: "export_excludes", Type: cty.List(cty.String), Required: false},
+		"export_compression":           &hcldec.AttrSpec{Name: "export_compression", Type: cty.String, Required: false},
+		"export_compression_level":     &hcldec.AttrSpec{Name: "export_compression_level", Type: cty.Number, Required: false},
 		"image":                        &hcldec.AttrSpec{Name: "image", Type: cty.String, Required: false},
+		"labels":                       &hcldec.AttrSpec{Name: "labels", Type: cty.Map(cty.String), Required: false},
 		"message":                      &hcldec.AttrSpec{Name: "message", Type: cty.String, Required: false},
+		"squash":                       &hcldec.AttrSpec{Name: "squash", Type: cty.String, Required: false},
+		"format":                       &hcldec.AttrSpec{Name: "format", Type: cty.String, Required: false},
 		"privileged":                   &hcldec.AttrSpec{Name: "privileged", Type: cty.Bool, Required: false},
 		"pty":                          &hcldec.AttrSpec{Name: "pty", Type: cty.Bool, Required: false},
 		"pull":                         &hcldec.AttrSpec{Name: "pull", Type: cty.Bool, Required: false},
+		"pull_policy":                  &hcldec.AttrSpec{Name: "pull_policy", Type: cty.String, Required: false},
 		"run_command":                  &hcldec.AttrSpec{Name: "run_command", Type: cty.List(cty.String), Required: false},
 		"tmpfs":                        &hcldec.AttrSpec{Name: "tmpfs", Type: cty.List(cty.String), Required: false},
+		"mount":                        &hcldec.BlockListSpec{TypeName: "mount", Nested: hcldec.ObjectSpec((*FlatMountConfig)(nil).HCL2Spec())},
 		"volumes":                      &hcldec.AttrSpec{Name: "volumes", Type: cty.Map(cty.String), Required: false},
 		"fix_upload_owner":             &hcldec.AttrSpec{Name: "fix_upload_owner", Type: cty.Bool, Required: false},
+		"container_logs_path":          &hcldec.AttrSpec{Name: "container_logs_path", Type: cty.String, Required: false},
+		"keep_container":               &hcldec.AttrSpec{Name: "keep_container", Type: cty.Bool, Required: false},
+		"cleanup_orphans":              &hcldec.AttrSpec{Name: "cleanup_orphans", Type: cty.Bool, Required: false},
+		"stop_before_commit":           &hcldec.AttrSpec{Name: "stop_before_commit", Type: cty.Bool, Required: false},
+		"stop_signal":                  &hcldec.AttrSpec{Name: "stop_signal", Type: cty.String, Required: false},
+		"stop_timeout":                 &hcldec.AttrSpec{Name: "stop_timeout", Type: cty.String, Required: false},
+		"pause_before_commit":          &hcldec.AttrSpec{Name: "pause_before_commit", Type: cty.Bool, Required: false},
+		"cleanup_paths":                &hcldec.AttrSpec{Name: "cleanup_paths", Type: cty.List(cty.String), Required: false},
+		"cleanup_profiles":             &hcldec.AttrSpec{Name: "cleanup_profiles", Type: cty.List(cty.String), Required: false},
 		"systemd":                      &hcldec.AttrSpec{Name: "systemd", Type: cty.String, Required: false},
+		"ready_check":                  &hcldec.AttrSpec{Name: "ready_check", Type: cty.String, Required: false},
+		"ready_command":                &hcldec.AttrSpec{Name: "ready_command", Type: cty.String, Required: false},
+		"ready_timeout":                &hcldec.AttrSpec{Name: "ready_timeout", Type: cty.String, Required: false},
 		"login":                        &hcldec.AttrSpec{Name: "login", Type: cty.Bool, Required: false},
 		"login_password":               &hcldec.AttrSpec{Name: "login_password", Type: cty.String, Required: false},
 		"login_server":                 &hcldec.AttrSpec{Name: "login_server", Type: cty.String, Required: false},
 		"login_username":               &hcldec.AttrSpec{Name: "login_username", Type: cty.String, Required: false},
+		"login_credential_helper":      &hcldec.AttrSpec{Name: "login_credential_helper", Type: cty.String, Required: false},
+		"login_skip_tls_verify":        &hcldec.AttrSpec{Name: "login_skip_tls_verify", Type: cty.Bool, Required: false},
+		"login_cert_dir":               &hcldec.AttrSpec{Name: "login_cert_dir", Type: cty.String, Required: false},
+		"authfile":                     &hcldec.AttrSpec{Name: "authfile", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatMountConfig is an auto-generated flat version of MountConfig.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatMountConfig struct {
+	Type        *string  `mapstructure:"type" required:"false" cty:"type" hcl:"type"`
+	Source      *string  `mapstructure:"source" required:"false" cty:"source" hcl:"source"`
+	Destination *string  `mapstructure:"destination" required:"true" cty:"destination" hcl:"destination"`
+	ReadOnly    *bool    `mapstructure:"read_only" required:"false" cty:"read_only" hcl:"read_only"`
+	Relabel     *string  `mapstructure:"relabel" required:"false" cty:"relabel" hcl:"relabel"`
+	Propagation *string  `mapstructure:"propagation" required:"false" cty:"propagation" hcl:"propagation"`
+	Options     []string `mapstructure:"options" required:"false" cty:"options" hcl:"options"`
+}
+
+// FlatMapstructure returns a new FlatMountConfig.
+// FlatMountConfig is an auto-generated flat version of MountConfig.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*MountConfig) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatMountConfig)
+}
+
+// HCL2Spec returns the hcl spec of a MountConfig.
+// This spec is used by HCL to read the fields of MountConfig.
+// The decoded values from this spec will then be applied to a FlatMountConfig.
+func (*FlatMountConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"type":        &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"source":      &hcldec.AttrSpec{Name: "source", Type: cty.String, Required: false},
+		"destination": &hcldec.AttrSpec{Name: "destination", Type: cty.String, Required: false},
+		"read_only":   &hcldec.AttrSpec{Name: "read_only", Type: cty.Bool, Required: false},
+		"relabel":     &hcldec.AttrSpec{Name: "relabel", Type: cty.String, Required: false},
+		"propagation": &hcldec.AttrSpec{Name: "propagation", Type: cty.String, Required: false},
+		"options":     &hcldec.AttrSpec{Name: "options", Type: cty.List(cty.String), Required: false},
 	}
 	return s
 }
@@ -2,7 +2,13 @@ package podman
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 func testConfig() map[string]interface{} {
@@ -144,3 +150,547 @@ func TestConfigPrepare_pull(t *testing.T) {
 		t.Fatal("should not pull")
 	}
 }
+
+func TestConfigPrepare_mounts(t *testing.T) {
+	raw := testConfig()
+
+	// Type defaults to bind
+	raw["mount"] = []map[string]interface{}{
+		{"source": "/host", "destination": "/guest"},
+	}
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.Mounts[0].Type != "bind" {
+		t.Fatalf("bad type: %s", c.Mounts[0].Type)
+	}
+
+	// Good mounts of every type
+	raw["mount"] = []map[string]interface{}{
+		{"source": "/host", "destination": "/guest", "read_only": true, "relabel": "private", "propagation": "rslave"},
+		{"type": "volume", "source": "cache", "destination": "/cache"},
+		{"type": "tmpfs", "destination": "/run/secrets", "options": []string{"tmpfs-size=16m"}},
+		{"type": "image", "source": "alpine", "destination": "/alpine"},
+	}
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	bad := []map[string]interface{}{
+		{"type": "nfs", "source": "/host", "destination": "/guest"},
+		{"source": "/host"},
+		{"destination": "/guest"},
+		{"type": "tmpfs", "source": "/host", "destination": "/guest"},
+		{"type": "volume", "source": "cache", "destination": "/cache", "relabel": "private"},
+		{"source": "/host", "destination": "/guest", "relabel": "Z"},
+		{"source": "/host", "destination": "/guest", "propagation": "bogus"},
+	}
+	for _, m := range bad {
+		raw["mount"] = []map[string]interface{}{m}
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigErr(t, warns, errs)
+	}
+}
+
+func TestConfigPrepare_volumes(t *testing.T) {
+	raw := testConfig()
+	raw["mount"] = []map[string]interface{}{
+		{"type": "tmpfs", "destination": "/run/secrets"},
+	}
+	raw["volumes"] = map[string]string{
+		"/srv/cache": "/var/cache/build",
+		"/host":      "/guest",
+	}
+
+	// The legacy volumes are converted to bind mounts, with a warning
+	var c Config
+	warns, errs := c.Prepare(raw)
+	if errs != nil {
+		t.Fatalf("bad: %#v", errs)
+	}
+	if len(warns) != 1 || !strings.Contains(warns[0], "volumes is deprecated") {
+		t.Fatalf("bad: %#v", warns)
+	}
+
+	expected := []MountConfig{
+		{Type: "tmpfs", Destination: "/run/secrets"},
+		{Type: "bind", Source: "/host", Destination: "/guest"},
+		{Type: "bind", Source: "/srv/cache", Destination: "/var/cache/build"},
+	}
+	if !reflect.DeepEqual(c.Mounts, expected) {
+		t.Fatalf("bad: %#v", c.Mounts)
+	}
+
+	// They're validated like mount blocks
+	raw["volumes"] = map[string]string{"/host": ""}
+	if _, errs = (&Config{}).Prepare(raw); errs == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestMountConfig_String(t *testing.T) {
+	cases := []struct {
+		mount    MountConfig
+		expected string
+	}{
+		{
+			MountConfig{Type: "bind", Source: "/host", Destination: "/guest"},
+			"type=bind,source=/host,destination=/guest",
+		},
+		{
+			MountConfig{Type: "bind", Source: "/host", Destination: "/guest", ReadOnly: true, Relabel: "shared", Propagation: "rshared"},
+			"type=bind,source=/host,destination=/guest,ro=true,relabel=shared,bind-propagation=rshared",
+		},
+		{
+			MountConfig{Type: "tmpfs", Destination: "/tmp", Options: []string{"tmpfs-size=64m", "U"}},
+			"type=tmpfs,destination=/tmp,tmpfs-size=64m,U",
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := tc.mount.String(); actual != tc.expected {
+			t.Fatalf("bad: expected %q, got %q", tc.expected, actual)
+		}
+	}
+}
+
+func TestConfigPrepare_squash(t *testing.T) {
+	raw := testConfig()
+	delete(raw, "export_path")
+	raw["commit"] = true
+
+	// Default
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.Squash != "none" {
+		t.Fatalf("bad squash: %s", c.Squash)
+	}
+
+	// Good values
+	for _, v := range []string{"none", "new", "all"} {
+		raw["squash"] = v
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigOk(t, warns, errs)
+	}
+
+	// Bad value
+	raw["squash"] = "some"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	// Squash without commit
+	raw = testConfig()
+	raw["squash"] = "new"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_format(t *testing.T) {
+	raw := testConfig()
+	delete(raw, "export_path")
+	raw["commit"] = true
+
+	// Default
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.Format != "oci" {
+		t.Fatalf("bad format: %s", c.Format)
+	}
+
+	// Good values
+	for _, v := range []string{"oci", "docker"} {
+		raw["format"] = v
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigOk(t, warns, errs)
+	}
+
+	// Bad value
+	raw["format"] = "v2s2"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	// Docker format can't be squashed through import
+	raw["format"] = "docker"
+	raw["squash"] = "all"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	delete(raw, "squash")
+
+	// Docker only changes warn with the oci format
+	raw["format"] = "oci"
+	raw["changes"] = []string{"onbuild RUN date", "USER nobody"}
+	warns, errs = (&Config{}).Prepare(raw)
+	if errs != nil {
+		t.Fatalf("bad: %s", errs)
+	}
+	if len(warns) != 1 {
+		t.Fatalf("bad: %#v", warns)
+	}
+
+	// but not with the docker one
+	raw["format"] = "docker"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	// Format without commit
+	raw = testConfig()
+	raw["format"] = "docker"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_changes(t *testing.T) {
+	raw := testConfig()
+
+	// Good changes
+	raw["changes"] = []string{
+		"USER www-data",
+		"WORKDIR /var/www",
+		"ENV HOSTNAME www.example.com",
+		"VOLUME /test1 /test2",
+		"EXPOSE 80 443",
+		"LABEL version=1.0",
+		"ONBUILD RUN date",
+		`CMD ["nginx", "-g", "daemon off;"]`,
+		"ENTRYPOINT /var/www/start.sh",
+	}
+	warns, errs := (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	// Every bad change is reported
+	raw["changes"] = []string{
+		"EXPOSE abc",
+		"MAINTAINER me",
+		"USER www-data",
+		"CMD [nginx]",
+	}
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	if n := len(errs.(*packersdk.MultiError).Errors); n != 3 {
+		t.Fatalf("expected 3 errors, got %d: %s", n, errs)
+	}
+}
+
+func TestConfigPrepare_readyCheck(t *testing.T) {
+	raw := testConfig()
+
+	// Defaults
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.ReadyCheck != "" {
+		t.Fatalf("bad ready_check: %s", c.ReadyCheck)
+	}
+	if c.ReadyTimeout != 5*time.Minute {
+		t.Fatalf("bad ready_timeout: %s", c.ReadyTimeout)
+	}
+
+	// A command implies the command check
+	raw["ready_command"] = "test -f /ready"
+	raw["ready_timeout"] = "30s"
+	c = Config{}
+	warns, errs = c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.ReadyCheck != "command" {
+		t.Fatalf("bad ready_check: %s", c.ReadyCheck)
+	}
+	if c.ReadyTimeout != 30*time.Second {
+		t.Fatalf("bad ready_timeout: %s", c.ReadyTimeout)
+	}
+
+	// The command check needs a command
+	delete(raw, "ready_command")
+	raw["ready_check"] = "command"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	// Bad check
+	raw["ready_check"] = "ping"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	for _, v := range []string{"healthcheck", "systemd"} {
+		raw["ready_check"] = v
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigOk(t, warns, errs)
+	}
+}
+
+func TestConfigPrepare_stopBeforeCommit(t *testing.T) {
+	raw := testConfig()
+
+	// Defaults
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.StopTimeout != 10*time.Second {
+		t.Fatalf("bad stop_timeout: %s", c.StopTimeout)
+	}
+
+	raw["stop_before_commit"] = true
+	raw["stop_signal"] = "SIGRTMIN+3"
+	raw["stop_timeout"] = "1m"
+	c = Config{}
+	warns, errs = c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.StopTimeout != time.Minute {
+		t.Fatalf("bad stop_timeout: %s", c.StopTimeout)
+	}
+
+	// Bad signal
+	raw["stop_signal"] = "sigterm!"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	// Stop and pause are exclusive
+	raw["stop_signal"] = "SIGTERM"
+	raw["pause_before_commit"] = true
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	delete(raw, "stop_before_commit")
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+}
+
+func TestConfigPrepare_containerName(t *testing.T) {
+	raw := testConfig()
+
+	// Defaults
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if !strings.HasPrefix(c.ContainerName, "packer-") {
+		t.Fatalf("bad container_name: %s", c.ContainerName)
+	}
+
+	raw["container_name"] = "web_1.build-2"
+	c = Config{}
+	warns, errs = c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.ContainerName != "web_1.build-2" {
+		t.Fatalf("bad container_name: %s", c.ContainerName)
+	}
+
+	for _, name := range []string{"-web", "web/1", "web 1"} {
+		raw["container_name"] = name
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigErr(t, warns, errs)
+	}
+}
+
+func TestDefaultContainerName(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cases := map[string]string{
+		"":                  "packer-1700000000",
+		"web":               "packer-web-1700000000",
+		"podman.fedora:40":  "packer-podman.fedora-40-1700000000",
+		"build with spaces": "packer-build-with-spaces-1700000000",
+	}
+	for buildName, expected := range cases {
+		if name := defaultContainerName(buildName, now); name != expected {
+			t.Fatalf("bad name for %q: %s", buildName, name)
+		}
+	}
+}
+
+func TestConfigPrepare_exportCompression(t *testing.T) {
+	raw := testConfig()
+
+	// Defaults
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.ExportCompression != "none" {
+		t.Fatalf("bad export_compression: %s", c.ExportCompression)
+	}
+
+	raw["export_compression"] = "zstd"
+	raw["export_compression_level"] = 19
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	// Bad level
+	raw["export_compression_level"] = 30
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	// Compression without export
+	delete(raw, "export_compression_level")
+	delete(raw, "export_path")
+	raw["commit"] = true
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_exportFormat(t *testing.T) {
+	raw := testConfig()
+
+	// Defaults
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.ExportFormat != "tar" {
+		t.Fatalf("bad export_format: %s", c.ExportFormat)
+	}
+
+	// Excludes apply to every format
+	raw["export_excludes"] = []string{"/var/cache/*"}
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	raw["export_format"] = "directory"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	// Relative or bad globs
+	for _, glob := range []string{"var/cache", "/var/[cache"} {
+		raw["export_excludes"] = []string{glob}
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigErr(t, warns, errs)
+	}
+	delete(raw, "export_excludes")
+
+	// Directories aren't compressed
+	raw["export_compression"] = "gzip"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	delete(raw, "export_compression")
+
+	// The directory can't be a file
+	f, err := os.CreateTemp(t.TempDir(), "rootfs")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.Close() //nolint:errcheck
+	raw["export_path"] = f.Name()
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	raw["export_format"] = "zip"
+	raw["export_path"] = "foo"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_exportDisk(t *testing.T) {
+	testDiskTools(t, "mkfs.ext4", "qemu-img")
+	raw := testConfig()
+
+	// Disk options require a disk format
+	raw["export_disk_size"] = "4G"
+	warns, errs := (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	for _, format := range []string{"ext4", "raw", "qcow2"} {
+		raw["export_format"] = format
+		var c Config
+		warns, errs = c.Prepare(raw)
+		testConfigOk(t, warns, errs)
+		if c.ExportDiskLabel != "rootfs" {
+			t.Fatalf("bad export_disk_label: %s", c.ExportDiskLabel)
+		}
+	}
+
+	raw["export_disk_size"] = "4X"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	delete(raw, "export_disk_size")
+
+	raw["export_disk_label"] = "a-label-longer-than-16"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	delete(raw, "export_disk_label")
+
+	raw["export_compression"] = "xz"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	delete(raw, "export_compression")
+
+	// The tools are checked before the build
+	testDiskTools(t, "mkfs.ext4")
+	raw["export_format"] = "qcow2"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+	testGeteuid(t, 1000)
+	raw["export_format"] = "ext4"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_cleanup(t *testing.T) {
+	raw := testConfig()
+
+	raw["cleanup_paths"] = []string{"/var/log/*.log", "/root/.ssh"}
+	raw["cleanup_profiles"] = []string{"dnf", "tmp"}
+	warns, errs := (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	// Relative or bad globs, and the root itself
+	for _, glob := range []string{"var/log", "/var/[log", "/", "//"} {
+		raw["cleanup_paths"] = []string{glob}
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigErr(t, warns, errs)
+	}
+	delete(raw, "cleanup_paths")
+
+	raw["cleanup_profiles"] = []string{"yum"}
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_pullPolicy(t *testing.T) {
+	raw := testConfig()
+
+	var c Config
+	warns, errs := c.Prepare(raw)
+	testConfigOk(t, warns, errs)
+	if c.PullPolicy != "always" {
+		t.Fatalf("bad pull_policy: %s", c.PullPolicy)
+	}
+
+	for _, policy := range []string{"always", "missing", "newer", "never"} {
+		raw["pull_policy"] = policy
+		warns, errs = (&Config{}).Prepare(raw)
+		testConfigOk(t, warns, errs)
+	}
+
+	raw["pull_policy"] = "sometimes"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
+
+func TestConfigPrepare_authFile(t *testing.T) {
+	raw := testConfig()
+
+	raw["authfile"] = filepath.Join(t.TempDir(), "missing.json")
+	warns, errs := (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	f, err := os.CreateTemp(t.TempDir(), "auth")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.Close() //nolint:errcheck
+	raw["authfile"] = f.Name()
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+}
+
+func TestConfigPrepare_loginCredentialHelper(t *testing.T) {
+	raw := testConfig()
+
+	raw["login_credential_helper"] = "ecr-login"
+	warns, errs := (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+
+	raw["login"] = true
+	raw["login_server"] = "123.dkr.ecr.us-east-1.amazonaws.com"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigOk(t, warns, errs)
+
+	raw["login_password"] = "secret"
+	warns, errs = (&Config{}).Prepare(raw)
+	testConfigErr(t, warns, errs)
+}
@@ -0,0 +1,69 @@
+package podman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// credentialHelperPrefix is the prefix of the names of the credential
+// helpers of Docker, like docker-credential-ecr-login.
+const credentialHelperPrefix = "docker-credential-"
+
+// helperCredentials are the credentials returned by the get command of a
+// credential helper.
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// credentialHelperPath returns the command of a credential helper, given its
+// name without the docker-credential- prefix, like ecr-login or gcr, or its
+// path.
+func credentialHelperPath(helper string) string {
+	if strings.ContainsRune(helper, '/') || strings.HasPrefix(helper, credentialHelperPrefix) {
+		return helper
+	}
+	return credentialHelperPrefix + helper
+}
+
+// credentialHelperGet gets the credentials of the server from the credential
+// helper, using the protocol of the Docker credential helpers: the server is
+// written to the standard input of `<helper> get`, which writes the
+// credentials to its standard output as JSON.
+func credentialHelperGet(helper, server string) (string, string, error) {
+	path := credentialHelperPath(helper)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("Getting the credentials of %s from %s", server, path)
+	if err := cmd.Run(); err != nil {
+		// Helpers write their errors, like "credentials not found in native
+		// keychain", to their standard output.
+		msg := strings.TrimSpace(stdout.String() + "\n" + stderr.String())
+		return "", "", fmt.Errorf("Error running credential helper %s: %s: %s", path, err, msg) //nolint:staticcheck
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("Error decoding the output of credential helper %s: %s", path, err) //nolint:staticcheck
+	}
+	// Identity tokens are exchanged for access tokens by docker, podman
+	// can't log in with them.
+	if creds.Username == "<token>" {
+		return "", "", fmt.Errorf("Credential helper %s returned an identity token, which podman doesn't support", path) //nolint:staticcheck
+	}
+	if creds.Username == "" || creds.Secret == "" {
+		return "", "", fmt.Errorf("Credential helper %s returned no credentials for %s", path, server) //nolint:staticcheck
+	}
+
+	return creds.Username, creds.Secret, nil
+}
@@ -0,0 +1,84 @@
+package podman
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testCredentialHelper writes a credential helper running the script, and
+// returns its path. The server read from stdin is written to server.txt next
+// to it.
+func testCredentialHelper(t *testing.T, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper stubs are shell scripts")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker-credential-stub")
+	content := "#!/bin/sh\n" +
+		"[ \"$1\" = get ] || exit 2\n" +
+		"cat > \"$(dirname \"$0\")/server.txt\"\n" +
+		script + "\n"
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return path
+}
+
+func TestCredentialHelperPath(t *testing.T) {
+	cases := map[string]string{
+		"ecr-login":                  "docker-credential-ecr-login",
+		"docker-credential-gcr":      "docker-credential-gcr",
+		"/usr/local/bin/my-helper":   "/usr/local/bin/my-helper",
+		"./docker-credential-helper": "./docker-credential-helper",
+	}
+	for helper, expected := range cases {
+		if actual := credentialHelperPath(helper); actual != expected {
+			t.Fatalf("%s: bad: %s", helper, actual)
+		}
+	}
+}
+
+func TestCredentialHelperGet(t *testing.T) {
+	helper := testCredentialHelper(t,
+		`echo '{"ServerURL":"123.dkr.ecr.us-east-1.amazonaws.com","Username":"AWS","Secret":"token"}'`)
+
+	username, secret, err := credentialHelperGet(helper, "123.dkr.ecr.us-east-1.amazonaws.com")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if username != "AWS" || secret != "token" {
+		t.Fatalf("bad credentials: %s %s", username, secret)
+	}
+
+	server, err := os.ReadFile(filepath.Join(filepath.Dir(helper), "server.txt"))
+	if err != nil || string(server) != "123.dkr.ecr.us-east-1.amazonaws.com" {
+		t.Fatalf("bad server: %q %v", server, err)
+	}
+}
+
+func TestCredentialHelperGet_errors(t *testing.T) {
+	cases := map[string]string{
+		"not found":      "echo 'credentials not found in native keychain'; exit 1",
+		"bad json":       "echo 'not json'",
+		"identity token": `echo '{"Username":"<token>","Secret":"refresh"}'`,
+		"no credentials": `echo '{}'`,
+	}
+	for name, script := range cases {
+		helper := testCredentialHelper(t, script)
+		_, _, err := credentialHelperGet(helper, "registry.example.com")
+		if err == nil {
+			t.Fatalf("%s: should error", name)
+		}
+		if name == "not found" && !strings.Contains(err.Error(), "credentials not found") {
+			t.Fatalf("%s: bad error: %s", name, err)
+		}
+	}
+
+	if _, _, err := credentialHelperGet(filepath.Join(t.TempDir(), "missing"), "registry.example.com"); err == nil {
+		t.Fatal("should error")
+	}
+}
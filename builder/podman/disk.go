@@ -0,0 +1,209 @@
+package podman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// partitionOffset is where the partition of the raw and qcow2 disks
+	// starts, aligned on 1MiB like partitioning tools do.
+	partitionOffset = 1 << 20
+	sectorSize      = 512
+	mib             = 1 << 20
+)
+
+// diskFormats are the export formats making a filesystem or disk image.
+var diskFormats = []string{"ext4", "raw", "qcow2"}
+
+var sizeRegexp = regexp.MustCompile(`^([0-9]+)([KMGT]?)$`)
+
+// geteuid returns the user Packer runs as. It is a variable so that tests can
+// run as another user.
+var geteuid = os.Geteuid
+
+// parseSize parses a size like 512M or 4G, in binary units. A size without
+// unit is in bytes.
+func parseSize(s string) (int64, error) {
+	m := sizeRegexp.FindStringSubmatch(strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(s), "iB")))
+	if m == nil {
+		return 0, fmt.Errorf("%q must be a number followed by an optional K, M, G or T unit", s)
+	}
+
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	shift := map[string]uint{"": 0, "K": 10, "M": 20, "G": 30, "T": 40}[m[2]]
+	if n > (1<<62)>>shift {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+
+	return n << shift, nil
+}
+
+// autoDiskSize returns a filesystem size leaving room for the metadata of
+// ext4 and some free space, from the size of the files to store.
+func autoDiskSize(used int64) int64 {
+	size := used + used/2 + 128*mib
+	return (size + mib - 1) / mib * mib
+}
+
+// dirSize returns the size used by the files of a directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// Count 4KiB blocks, so that many small files aren't underestimated
+		size += (info.Size() + 4095) / 4096 * 4096
+		return nil
+	})
+	return size, err
+}
+
+// checkDiskTools checks that images of the given format can be made, so that
+// the build fails before it starts rather than once it is done.
+func checkDiskTools(format string) error {
+	// mkfs.ext4 records the owners of the files in rootfs, which are all the
+	// user running Packer when it can't preserve them.
+	if uid := geteuid(); uid != 0 {
+		return fmt.Errorf("Packer must run as root to make %s images, otherwise all their files would be owned by the user %d", format, uid) //nolint:staticcheck
+	}
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		return fmt.Errorf("mkfs.ext4 is required to make %s images, it is usually provided by the e2fsprogs package", format) //nolint:staticcheck
+	}
+	if format == "qcow2" {
+		if _, err := exec.LookPath("qemu-img"); err != nil {
+			return fmt.Errorf("qemu-img is required to make qcow2 images, it is usually provided by the qemu-img or qemu-utils package") //nolint:staticcheck
+		}
+	}
+
+	return nil
+}
+
+// makeDisk writes an image of the given format to path, holding an ext4
+// filesystem made from the files of rootfs. The size is the one of the
+// filesystem, or computed from the files if 0.
+func makeDisk(path string, format string, rootfs string, size int64, label string) error {
+	if size == 0 {
+		used, err := dirSize(rootfs)
+		if err != nil {
+			return err
+		}
+		size = autoDiskSize(used)
+		log.Printf("Using a filesystem of %d MiB for %d bytes of files", size/mib, used)
+	}
+
+	image := path
+	if format == "qcow2" {
+		// The raw disk is converted once made
+		image = path + ".raw"
+		defer os.Remove(image) //nolint:errcheck
+	}
+
+	offset := int64(0)
+	if format != "ext4" {
+		offset = partitionOffset
+	}
+	if err := createSparse(image, offset+size); err != nil {
+		return err
+	}
+	if offset > 0 {
+		if err := writeMBR(image, offset, size); err != nil {
+			return fmt.Errorf("Error writing the partition table: %s", err) //nolint:staticcheck
+		}
+	}
+
+	// The root of the filesystem is owned by root, like in the container.
+	args := []string{
+		"-F", "-q", "-t", "ext4",
+		"-L", label,
+		"-d", rootfs,
+		"-E", fmt.Sprintf("offset=%d,root_owner=0:0", offset),
+		image, strconv.FormatInt(size/1024, 10) + "k",
+	}
+	if err := runTool("mkfs.ext4", args...); err != nil {
+		return err
+	}
+
+	if format == "qcow2" {
+		return runTool("qemu-img", "convert", "-f", "raw", "-O", "qcow2", image, path)
+	}
+	return nil
+}
+
+// createSparse creates a sparse file of the given size.
+func createSparse(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	return f.Close()
+}
+
+// writeMBR writes an MBR partition table with a single bootable Linux
+// partition, starting at offset and of the given size.
+func writeMBR(path string, offset int64, size int64) error {
+	start := offset / sectorSize
+	sectors := size / sectorSize
+	if start+sectors > 1<<32-1 {
+		return fmt.Errorf("disks larger than 2TiB aren't supported")
+	}
+
+	mbr := make([]byte, sectorSize)
+	entry := mbr[446:462]
+	entry[0] = 0x80 // bootable
+	// The CHS addresses are unused, set to their maximum like for disks
+	// too large for them.
+	copy(entry[1:4], []byte{0xfe, 0xff, 0xff})
+	entry[4] = 0x83 // Linux
+	copy(entry[5:8], []byte{0xfe, 0xff, 0xff})
+	binary.LittleEndian.PutUint32(entry[8:12], uint32(start))
+	binary.LittleEndian.PutUint32(entry[12:16], uint32(sectors))
+	mbr[510], mbr[511] = 0x55, 0xaa
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(mbr, 0); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	return f.Close()
+}
+
+// runTool runs a local command, returning its output in the error if it
+// fails.
+func runTool(name string, args ...string) error {
+	var output bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	log.Printf("Executing: %s %v", name, args)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error running %s: %s\n\nOutput: %s", name, err, output.String()) //nolint:staticcheck
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package podman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	valid := map[string]int64{
+		"1024":  1024,
+		"512K":  512 << 10,
+		"512M":  512 << 20,
+		"4G":    4 << 30,
+		"4g":    4 << 30,
+		"4GiB":  4 << 30,
+		"1T":    1 << 40,
+		" 16M ": 16 << 20,
+	}
+	for s, expected := range valid {
+		size, err := parseSize(s)
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		if size != expected {
+			t.Fatalf("%q: bad size %d", s, size)
+		}
+	}
+
+	for _, s := range []string{"", "4X", "-1G", "1.5G", "99999999999T"} {
+		if _, err := parseSize(s); err == nil {
+			t.Fatalf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestAutoDiskSize(t *testing.T) {
+	if size := autoDiskSize(0); size != 128*mib {
+		t.Fatalf("bad size: %d", size)
+	}
+	if size := autoDiskSize(100*mib + 1); size != 279*mib {
+		t.Fatalf("bad size: %d", size)
+	}
+}
+
+func TestWriteMBR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.raw")
+	if err := createSparse(path, 9*mib); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := writeMBR(path, partitionOffset, 8*mib); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(data) != 9*mib {
+		t.Fatalf("bad size: %d", len(data))
+	}
+	entry := data[446:462]
+	if entry[0] != 0x80 || entry[4] != 0x83 {
+		t.Fatalf("bad partition: %x", entry)
+	}
+	if start := binary.LittleEndian.Uint32(entry[8:12]); start != 2048 {
+		t.Fatalf("bad start: %d", start)
+	}
+	if sectors := binary.LittleEndian.Uint32(entry[12:16]); sectors != 16384 {
+		t.Fatalf("bad sectors: %d", sectors)
+	}
+	if !bytes.Equal(data[510:512], []byte{0x55, 0xaa}) {
+		t.Fatalf("bad signature: %x", data[510:512])
+	}
+}
+
+// testExt4 checks the ext4 superblock at the given offset of the image.
+func testExt4(t *testing.T, path string, offset int64, label string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	sb := make([]byte, 1024)
+	if _, err := f.ReadAt(sb, offset+1024); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if magic := binary.LittleEndian.Uint16(sb[56:58]); magic != 0xef53 {
+		t.Fatalf("bad magic: %x", magic)
+	}
+	if name := string(bytes.TrimRight(sb[120:136], "\x00")); name != label {
+		t.Fatalf("bad label: %q", name)
+	}
+}
+
+// testGeteuid makes the tests run as uid, for the duration of the test.
+func testGeteuid(t *testing.T, uid int) {
+	old := geteuid
+	t.Cleanup(func() { geteuid = old })
+	geteuid = func() int { return uid }
+}
+
+func TestMakeDisk(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 isn't installed")
+	}
+
+	rootfs := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootfs, "hostname"), []byte("web\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir := t.TempDir()
+	ext4 := filepath.Join(dir, "rootfs.ext4")
+	if err := makeDisk(ext4, "ext4", rootfs, 0, "web"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testExt4(t, ext4, 0, "web")
+
+	raw := filepath.Join(dir, "disk.raw")
+	if err := makeDisk(raw, "raw", rootfs, 64*mib, "rootfs"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err := os.Stat(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Size() != partitionOffset+64*mib {
+		t.Fatalf("bad size: %d", fi.Size())
+	}
+	testExt4(t, raw, partitionOffset, "rootfs")
+}
+
+// testDiskTools makes the given tools the only ones in the PATH, as scripts
+// doing nothing, and the tests run as root, for the duration of the test.
+func testDiskTools(t *testing.T, tools ...string) {
+	dir := t.TempDir()
+	for _, tool := range tools {
+		if err := os.WriteFile(filepath.Join(dir, tool), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	testGeteuid(t, 0)
+}
+
+func TestCheckDiskTools(t *testing.T) {
+	testDiskTools(t, "mkfs.ext4")
+	if err := checkDiskTools("raw"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := checkDiskTools("qcow2"); err == nil || !strings.Contains(err.Error(), "qemu-img") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	testDiskTools(t, "mkfs.ext4", "qemu-img")
+	if err := checkDiskTools("qcow2"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testDiskTools(t)
+	if err := checkDiskTools("ext4"); err == nil || !strings.Contains(err.Error(), "mkfs.ext4") {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// The owners of the files would be lost when not running as root
+	testDiskTools(t, "mkfs.ext4")
+	testGeteuid(t, 1000)
+	if err := checkDiskTools("ext4"); err == nil || !strings.Contains(err.Error(), "must run as root") {
+		t.Fatalf("bad: %v", err)
+	}
+}
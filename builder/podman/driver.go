@@ -1,7 +1,9 @@
 package podman
 
 import (
+	"context"
 	"io"
+	"time"
 
 	"github.com/hashicorp/go-version"
 )
@@ -10,15 +12,50 @@ import (
 // Podman. The Driver interface also allows the steps to be tested since
 // a mock driver can be shimmed in.
 type Driver interface {
-	// Commit the container to a tag
-	Commit(id string, author string, changes []string, message string) (string, error)
+	// Commit the container to a tag using the given image format. If squash
+	// is true, the new layers are squashed into a single one.
+	Commit(id string, author string, changes []string, message string, squash bool, format string) (string, error)
+
+	// Cmd returns the default command of the image.
+	Cmd(id string) ([]string, error)
+
+	// ContainersByLabel returns the value of the given label for all the
+	// containers having it, running or not, by container ID.
+	ContainersByLabel(key string) (map[string]string, error)
+
+	// ContainerState returns the state of the container.
+	ContainerState(id string) (*ContainerState, error)
 
 	// Delete an image that is imported into Podman
 	DeleteImage(id string) error
 
+	// Digest returns the digest of the manifest of the image.
+	Digest(id string) (string, error)
+
+	// Entrypoint returns the entrypoint of the image.
+	Entrypoint(id string) ([]string, error)
+
+	// Env returns the environment variables of the image, in the KEY=VALUE
+	// form.
+	Env(id string) ([]string, error)
+
+	// ExposedPorts returns the ports exposed by the image, like 80/tcp.
+	ExposedPorts(id string) ([]string, error)
+
+	// Exec runs the command inside the container and returns its combined
+	// output. An error is returned if the command exits with a non-zero
+	// status, or is killed because the context is done.
+	Exec(ctx context.Context, id string, command []string) (string, error)
+
 	// Export exports the container with the given ID to the given writer.
 	Export(id string, dst io.Writer) error
 
+	// Healthcheck runs the healthcheck of the container and returns whether
+	// it is healthy. An error is returned if the check can't be run, for
+	// example because the image has no healthcheck, or is killed because the
+	// context is done.
+	Healthcheck(ctx context.Context, id string) (bool, error)
+
 	// Import imports a container from a tar file
 	Import(path string, changes []string, repo string) (string, error)
 
@@ -29,18 +66,29 @@ type Driver interface {
 	// Sha256 returns the sha256 id of the image
 	Sha256(id string) (string, error)
 
-	// Login. This will lock the driver from performing another Login
-	// until Logout is called. Therefore, any users MUST call Logout.
-	Login(repo, username, password string) error
+	// Labels returns the labels of the image.
+	Labels(id string) (map[string]string, error)
+
+	// Login logs in to a registry, storing the credentials in the auth file
+	// of the config rather than in the auth file of the user.
+	Login(config *LoginConfig) error
+
+	// Logs follows the logs of the container, stdout and stderr, writing
+	// them to the given writer until the container exits or the context is
+	// done.
+	Logs(ctx context.Context, id string, dst io.Writer) error
 
-	// Logout. This can only be called if Login succeeded.
-	Logout(repo string) error
+	// Logout removes the credentials of the registry from the auth file.
+	Logout(repo, authfile string) error
 
-	// Pull should pull down the given image.
-	Pull(image string) error
+	// Pull should pull down the given image, according to the pull policy
+	// of podman pull: always, missing, newer or never. The credentials are
+	// read from the auth file, if not empty.
+	Pull(image, policy, authfile string) error
 
-	// Push pushes an image to a Podman index/registry.
-	Push(name string) error
+	// Push pushes an image to a Podman index/registry, with the credentials
+	// of the auth file, if not empty.
+	Push(name, authfile string) error
 
 	// Save an image with the given ID to the given writer.
 	SaveImage(id string, dst io.Writer) error
@@ -49,33 +97,90 @@ type Driver interface {
 	// along with a potential error.
 	StartContainer(*ContainerConfig) (string, error)
 
-	// KillContainer forcibly stops a container.
+	// KillContainer forcibly stops and removes a container. It isn't an
+	// error if the container doesn't exist.
 	KillContainer(id string) error
 
-	// StopContainer gently stops a container.
-	StopContainer(id string) error
+	// PathInImage returns whether the path exists in the filesystem of the
+	// image.
+	PathInImage(image string, path string) (bool, error)
 
-	// TagImage tags the image with the given ID
-	TagImage(id string, repo string, force bool) error
+	// PauseContainer pauses all the processes of a container.
+	PauseContainer(id string) error
+
+	// RemoveMountPoint removes the empty directory podman created in the
+	// filesystem of a container to mount a volume on, so that it isn't
+	// committed nor exported. The volume is unmounted from the container.
+	RemoveMountPoint(id string, dir string) error
+
+	// StopContainer gently stops a container, by sending it the given signal,
+	// or its stop signal if empty, and killing it if it is still running
+	// after the timeout.
+	StopContainer(id string, signal string, timeout time.Duration) error
+
+	// TagImage tags the image with the given ID. podman tag always moves an
+	// existing tag.
+	TagImage(id string, repo string) error
+
+	// UnpauseContainer resumes a container paused by PauseContainer.
+	UnpauseContainer(id string) error
+
+	// User returns the user the image runs as.
+	User(id string) (string, error)
 
 	// Verify verifies that the driver can run
 	Verify() error
 
 	// Version reads the Podman version
 	Version() (*version.Version, error)
+
+	// Capabilities detects what the Podman running the containers supports.
+	Capabilities() (*Capabilities, error)
+
+	// WorkingDir returns the working directory of the image.
+	WorkingDir(id string) (string, error)
 }
 
 // ContainerConfig is the configuration used to start a container.
 type ContainerConfig struct {
+	Name       string
+	Replace    bool
 	Image      string
 	RunCommand []string
 	Device     []string
 	CapAdd     []string
 	CapDrop    []string
-	Volumes    map[string]string
+	Mounts     []MountConfig
 	TmpFs      []string
 	Privileged bool
 	Systemd    string
+	Labels     map[string]string
+	// AuthFile holds the credentials used to pull the image, if not empty.
+	AuthFile string
+}
+
+// LoginConfig is the configuration of a registry login.
+type LoginConfig struct {
+	Server   string
+	Username string
+	// Password is written to the standard input of podman login, never on
+	// its command line nor in the logs.
+	Password string
+	AuthFile string
+	// SkipTLSVerify disables the verification of the certificate of the
+	// registry.
+	SkipTLSVerify bool
+	// CertDir is the directory of the certificates of the registry.
+	CertDir string
+}
+
+// ContainerState is the state of a container, as reported by podman inspect.
+type ContainerState struct {
+	Status    string
+	Running   bool
+	ExitCode  int
+	OOMKilled bool
+	Error     string
 }
 
 // This is the template that is used for the RunCommand in the ContainerConfig.
@@ -1,7 +1,9 @@
 package podman
 
 import (
+	"context"
 	"io"
+	"time"
 
 	"github.com/hashicorp/go-version"
 )
@@ -11,17 +13,74 @@ type MockDriver struct {
 	CommitCalled      bool
 	CommitContainerId string
 	CommitImageId     string
+	CommitChanges     []string
+	CommitSquash      bool
+	CommitFormat      string
 	CommitErr         error
 
+	CmdCalled bool
+	CmdId     string
+	CmdResult []string
+	CmdErr    error
+
+	EntrypointCalled bool
+	EntrypointId     string
+	EntrypointResult []string
+	EntrypointErr    error
+
+	EnvCalled bool
+	EnvResult []string
+	EnvErr    error
+
+	ExposedPortsCalled bool
+	ExposedPortsResult []string
+	ExposedPortsErr    error
+
+	LabelsCalled bool
+	LabelsResult map[string]string
+	LabelsErr    error
+
+	UserCalled bool
+	UserResult string
+	UserErr    error
+
+	WorkingDirCalled bool
+	WorkingDirResult string
+	WorkingDirErr    error
+
+	ContainerStateCalled bool
+	ContainerStateResult *ContainerState
+	ContainerStateErr    error
+
 	DeleteImageCalled bool
 	DeleteImageId     string
 	DeleteImageErr    error
 
-	ImportCalled bool
-	ImportPath   string
-	ImportRepo   string
-	ImportId     string
-	ImportErr    error
+	ContainersByLabelCalled bool
+	ContainersByLabelKey    string
+	ContainersByLabelResult map[string]string
+	ContainersByLabelErr    error
+
+	DigestCalled  []string
+	DigestResults map[string]string
+	DigestErr     error
+
+	ExecCalled  int
+	ExecCommand []string
+	ExecOutput  string
+	ExecErr     error
+	ExecHang    bool
+
+	HealthcheckCalled  int
+	HealthcheckHealthy bool
+	HealthcheckErr     error
+
+	ImportCalled  bool
+	ImportPath    string
+	ImportRepo    string
+	ImportChanges []string
+	ImportId      string
+	ImportErr     error
 
 	IPAddressCalled bool
 	IPAddressID     string
@@ -35,21 +94,46 @@ type MockDriver struct {
 
 	KillCalled bool
 	KillID     string
+	KillIDs    []string
 	KillError  error
 
-	LoginCalled   bool
-	LoginUsername string
-	LoginPassword string
-	LoginRepo     string
-	LoginErr      error
+	PathInImageCalled bool
+	PathInImageImage  string
+	PathInImagePath   string
+	PathInImageResult bool
+	PathInImageErr    error
+
+	PauseCalled bool
+	PauseID     string
+	PauseErr    error
+
+	RemoveMountPointCalled bool
+	RemoveMountPointID     string
+	RemoveMountPointDir    string
+	RemoveMountPointErr    error
+
+	UnpauseCalled bool
+	UnpauseID     string
+	UnpauseErr    error
 
-	LogoutCalled bool
-	LogoutRepo   string
-	LogoutErr    error
+	LoginCalled bool
+	LoginConfig *LoginConfig
+	LoginErr    error
 
-	PushCalled bool
-	PushName   string
-	PushErr    error
+	LogsCalled bool
+	LogsID     string
+	LogsOutput string
+	LogsErr    error
+
+	LogoutCalled   bool
+	LogoutRepo     string
+	LogoutAuthFile string
+	LogoutErr      error
+
+	PushCalled   bool
+	PushName     string
+	PushAuthFile string
+	PushErr      error
 
 	SaveImageCalled bool
 	SaveImageId     string
@@ -59,7 +143,6 @@ type MockDriver struct {
 	TagImageCalled  int
 	TagImageImageId string
 	TagImageRepo    []string
-	TagImageForce   bool
 	TagImageErr     error
 
 	ExportReader io.Reader
@@ -74,28 +157,93 @@ type MockDriver struct {
 	ExportID     string
 	PullCalled   bool
 	PullImage    string
+	PullPolicy   string
+	PullAuthFile string
+	// PullDigest is the digest of the image once pulled, if set.
+	PullDigest   string
 	StartCalled  bool
 	StartConfig  *ContainerConfig
 	StopCalled   bool
 	StopID       string
+	StopSignal   string
+	StopTimeout  time.Duration
 	VerifyCalled bool
 
 	VersionCalled  bool
 	VersionVersion string
+
+	// CapabilitiesResult defaults to a rootful podman 5.0.0 with cgroups v2.
+	CapabilitiesCalled bool
+	CapabilitiesResult *Capabilities
+	CapabilitiesErr    error
 }
 
-func (d *MockDriver) Commit(id string, author string, changes []string, message string) (string, error) {
+func (d *MockDriver) Commit(id string, author string, changes []string, message string, squash bool, format string) (string, error) {
 	d.CommitCalled = true
 	d.CommitContainerId = id
+	d.CommitChanges = changes
+	d.CommitSquash = squash
+	d.CommitFormat = format
 	return d.CommitImageId, d.CommitErr
 }
 
+func (d *MockDriver) Cmd(id string) ([]string, error) {
+	d.CmdCalled = true
+	d.CmdId = id
+	return d.CmdResult, d.CmdErr
+}
+
+func (d *MockDriver) ContainersByLabel(key string) (map[string]string, error) {
+	d.ContainersByLabelCalled = true
+	d.ContainersByLabelKey = key
+	return d.ContainersByLabelResult, d.ContainersByLabelErr
+}
+
+func (d *MockDriver) ContainerState(id string) (*ContainerState, error) {
+	d.ContainerStateCalled = true
+	if d.ContainerStateResult == nil && d.ContainerStateErr == nil {
+		return &ContainerState{Status: "running", Running: true}, nil
+	}
+	return d.ContainerStateResult, d.ContainerStateErr
+}
+
 func (d *MockDriver) DeleteImage(id string) error {
 	d.DeleteImageCalled = true
 	d.DeleteImageId = id
 	return d.DeleteImageErr
 }
 
+func (d *MockDriver) Digest(id string) (string, error) {
+	d.DigestCalled = append(d.DigestCalled, id)
+	return d.DigestResults[id], d.DigestErr
+}
+
+func (d *MockDriver) Entrypoint(id string) ([]string, error) {
+	d.EntrypointCalled = true
+	d.EntrypointId = id
+	return d.EntrypointResult, d.EntrypointErr
+}
+
+func (d *MockDriver) Env(id string) ([]string, error) {
+	d.EnvCalled = true
+	return d.EnvResult, d.EnvErr
+}
+
+func (d *MockDriver) ExposedPorts(id string) ([]string, error) {
+	d.ExposedPortsCalled = true
+	return d.ExposedPortsResult, d.ExposedPortsErr
+}
+
+func (d *MockDriver) Exec(ctx context.Context, id string, command []string) (string, error) {
+	d.ExecCalled += 1
+	d.ExecCommand = command
+	if d.ExecHang {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return d.ExecOutput, d.ExecErr
+}
+
 func (d *MockDriver) Export(id string, dst io.Writer) error {
 	d.ExportCalled = true
 	d.ExportID = id
@@ -110,10 +258,16 @@ func (d *MockDriver) Export(id string, dst io.Writer) error {
 	return d.ExportError
 }
 
+func (d *MockDriver) Healthcheck(ctx context.Context, id string) (bool, error) {
+	d.HealthcheckCalled += 1
+	return d.HealthcheckHealthy, d.HealthcheckErr
+}
+
 func (d *MockDriver) Import(path string, changes []string, repo string) (string, error) {
 	d.ImportCalled = true
 	d.ImportPath = path
 	d.ImportRepo = repo
+	d.ImportChanges = changes
 	return d.ImportId, d.ImportErr
 }
 
@@ -129,29 +283,52 @@ func (d *MockDriver) Sha256(id string) (string, error) {
 	return d.Sha256Result, d.Sha256Err
 }
 
-func (d *MockDriver) Login(r, u, p string) error {
+func (d *MockDriver) Labels(id string) (map[string]string, error) {
+	d.LabelsCalled = true
+	return d.LabelsResult, d.LabelsErr
+}
+
+func (d *MockDriver) Login(config *LoginConfig) error {
 	d.LoginCalled = true
-	d.LoginRepo = r
-	d.LoginUsername = u
-	d.LoginPassword = p
+	d.LoginConfig = config
 	return d.LoginErr
 }
 
-func (d *MockDriver) Logout(r string) error {
+func (d *MockDriver) Logs(ctx context.Context, id string, dst io.Writer) error {
+	d.LogsCalled = true
+	d.LogsID = id
+	if _, err := io.WriteString(dst, d.LogsOutput); err != nil {
+		return err
+	}
+	return d.LogsErr
+}
+
+func (d *MockDriver) Logout(r, authfile string) error {
 	d.LogoutCalled = true
 	d.LogoutRepo = r
+	d.LogoutAuthFile = authfile
 	return d.LogoutErr
 }
 
-func (d *MockDriver) Pull(image string) error {
+func (d *MockDriver) Pull(image, policy, authfile string) error {
 	d.PullCalled = true
 	d.PullImage = image
+	d.PullPolicy = policy
+	d.PullAuthFile = authfile
+	if d.PullDigest != "" && d.PullError == nil {
+		if d.DigestResults == nil {
+			d.DigestResults = map[string]string{}
+		}
+		d.DigestResults[image] = d.PullDigest
+		d.DigestErr = nil
+	}
 	return d.PullError
 }
 
-func (d *MockDriver) Push(name string) error {
+func (d *MockDriver) Push(name, authfile string) error {
 	d.PushCalled = true
 	d.PushName = name
+	d.PushAuthFile = authfile
 	return d.PushErr
 }
 
@@ -178,23 +355,56 @@ func (d *MockDriver) StartContainer(config *ContainerConfig) (string, error) {
 func (d *MockDriver) KillContainer(id string) error {
 	d.KillCalled = true
 	d.KillID = id
+	d.KillIDs = append(d.KillIDs, id)
 	return d.KillError
 }
 
-func (d *MockDriver) StopContainer(id string) error {
+func (d *MockDriver) PathInImage(image string, path string) (bool, error) {
+	d.PathInImageCalled = true
+	d.PathInImageImage = image
+	d.PathInImagePath = path
+	return d.PathInImageResult, d.PathInImageErr
+}
+
+func (d *MockDriver) PauseContainer(id string) error {
+	d.PauseCalled = true
+	d.PauseID = id
+	return d.PauseErr
+}
+
+func (d *MockDriver) RemoveMountPoint(id string, dir string) error {
+	d.RemoveMountPointCalled = true
+	d.RemoveMountPointID = id
+	d.RemoveMountPointDir = dir
+	return d.RemoveMountPointErr
+}
+
+func (d *MockDriver) StopContainer(id string, signal string, timeout time.Duration) error {
 	d.StopCalled = true
 	d.StopID = id
+	d.StopSignal = signal
+	d.StopTimeout = timeout
 	return d.StopError
 }
 
-func (d *MockDriver) TagImage(id string, repo string, force bool) error {
+func (d *MockDriver) UnpauseContainer(id string) error {
+	d.UnpauseCalled = true
+	d.UnpauseID = id
+	return d.UnpauseErr
+}
+
+func (d *MockDriver) TagImage(id string, repo string) error {
 	d.TagImageCalled += 1
 	d.TagImageImageId = id
 	d.TagImageRepo = append(d.TagImageRepo, repo)
-	d.TagImageForce = force
 	return d.TagImageErr
 }
 
+func (d *MockDriver) User(id string) (string, error) {
+	d.UserCalled = true
+	return d.UserResult, d.UserErr
+}
+
 func (d *MockDriver) Verify() error {
 	d.VerifyCalled = true
 	return d.VerifyError
@@ -204,3 +414,17 @@ func (d *MockDriver) Version() (*version.Version, error) {
 	d.VersionCalled = true
 	return version.NewVersion(d.VersionVersion)
 }
+
+func (d *MockDriver) Capabilities() (*Capabilities, error) {
+	d.CapabilitiesCalled = true
+	if d.CapabilitiesResult == nil {
+		v := version.Must(version.NewVersion("5.0.0"))
+		return &Capabilities{ClientVersion: v, ServerVersion: v, CgroupVersion: 2, OCIRuntime: "crun"}, d.CapabilitiesErr
+	}
+	return d.CapabilitiesResult, d.CapabilitiesErr
+}
+
+func (d *MockDriver) WorkingDir(id string) (string, error) {
+	d.WorkingDirCalled = true
+	return d.WorkingDirResult, d.WorkingDirErr
+}
@@ -2,17 +2,22 @@ package podman
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-version"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/shell-local/localexec"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
@@ -20,7 +25,10 @@ type PodmanDriver struct {
 	Ui  packersdk.Ui
 	Ctx *interpolate.Context
 
-	l sync.Mutex
+	// The capabilities are only detected once.
+	capsOnce sync.Once
+	caps     *Capabilities
+	capsErr  error
 }
 
 func (d *PodmanDriver) DeleteImage(id string) error {
@@ -43,7 +51,7 @@ func (d *PodmanDriver) DeleteImage(id string) error {
 	return nil
 }
 
-func (d *PodmanDriver) Commit(id string, author string, changes []string, message string) (string, error) {
+func (d *PodmanDriver) Commit(id string, author string, changes []string, message string, squash bool, format string) (string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
@@ -57,6 +65,12 @@ func (d *PodmanDriver) Commit(id string, author string, changes []string, messag
 	if message != "" {
 		args = append(args, "--message", message)
 	}
+	if squash {
+		args = append(args, "--squash")
+	}
+	if format != "" {
+		args = append(args, "--format", format)
+	}
 	args = append(args, id)
 
 	log.Printf("Committing container with args: %v", args)
@@ -78,6 +92,16 @@ func (d *PodmanDriver) Commit(id string, author string, changes []string, messag
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+func (d *PodmanDriver) Exec(ctx context.Context, id string, command []string) (string, error) {
+	args := append([]string{"exec", id}, command...)
+	output, err := exec.CommandContext(ctx, "podman", args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("Error running %v: %s\nOutput: %s", command, err, output) //nolint:staticcheck
+	}
+
+	return string(output), nil
+}
+
 func (d *PodmanDriver) Export(id string, dst io.Writer) error {
 	var stderr bytes.Buffer
 	cmd := exec.Command("podman", "export", id)
@@ -99,6 +123,25 @@ func (d *PodmanDriver) Export(id string, dst io.Writer) error {
 	return nil
 }
 
+func (d *PodmanDriver) Healthcheck(ctx context.Context, id string) (bool, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "podman", "healthcheck", "run", id)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	// podman exits with 1 when the container is unhealthy, other errors
+	// mean that the check couldn't be run at all.
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Error running healthcheck: %s\nStderr: %s", err, stderr.String()) //nolint:staticcheck
+}
+
 func (d *PodmanDriver) Import(path string, changes []string, repo string) (string, error) {
 	var stdout, stderr bytes.Buffer
 
@@ -109,7 +152,9 @@ func (d *PodmanDriver) Import(path string, changes []string, repo string) (strin
 	}
 
 	args = append(args, "-")
-	args = append(args, repo)
+	if repo != "" {
+		args = append(args, repo)
+	}
 
 	cmd := exec.Command("podman", args...)
 	cmd.Stdout = &stdout
@@ -187,120 +232,233 @@ func (d *PodmanDriver) Sha256(id string) (string, error) {
 	return strings.TrimSpace(stdout.String()), nil
 }
 
-func (d *PodmanDriver) Cmd(id string) (string, error) {
+func (d *PodmanDriver) Cmd(id string) ([]string, error) {
+	var cmd []string
+	err := d.inspect("image", id, "{{json .Config.Cmd}}", &cmd)
+	return cmd, err
+}
+
+func (d *PodmanDriver) Digest(id string) (string, error) {
+	var digest string
+	err := d.inspect("image", id, "{{json .Digest}}", &digest)
+	return digest, err
+}
+
+func (d *PodmanDriver) Entrypoint(id string) ([]string, error) {
+	var entrypoint []string
+	err := d.inspect("image", id, "{{json .Config.Entrypoint}}", &entrypoint)
+	return entrypoint, err
+}
+
+func (d *PodmanDriver) Env(id string) ([]string, error) {
+	var env []string
+	err := d.inspect("image", id, "{{json .Config.Env}}", &env)
+	return env, err
+}
+
+func (d *PodmanDriver) WorkingDir(id string) (string, error) {
+	var workdir string
+	err := d.inspect("image", id, "{{json .Config.WorkingDir}}", &workdir)
+	return workdir, err
+}
+
+func (d *PodmanDriver) User(id string) (string, error) {
+	var user string
+	err := d.inspect("image", id, "{{json .Config.User}}", &user)
+	return user, err
+}
+
+func (d *PodmanDriver) Labels(id string) (map[string]string, error) {
+	var labels map[string]string
+	err := d.inspect("image", id, "{{json .Config.Labels}}", &labels)
+	return labels, err
+}
+
+func (d *PodmanDriver) ExposedPorts(id string) ([]string, error) {
+	var exposed map[string]struct{}
+	if err := d.inspect("image", id, "{{json .Config.ExposedPorts}}", &exposed); err != nil {
+		return nil, err
+	}
+
+	ports := make([]string, 0, len(exposed))
+	for port := range exposed {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	return ports, nil
+}
+
+func (d *PodmanDriver) ContainerState(id string) (*ContainerState, error) {
+	var state ContainerState
+	if err := d.inspect("container", id, "{{json .State}}", &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ContainersByLabel lists the containers having the label, stopped ones
+// included, with podman ps, and returns the value of the label by container
+// ID.
+func (d *PodmanDriver) ContainersByLabel(key string) (map[string]string, error) {
 	var stderr, stdout bytes.Buffer
-	cmd := exec.Command(
-		"podman",
-		"inspect",
-		"--format",
-		"{{if .Config.Cmd}} {{json .Config.Cmd}} {{else}} [] {{end}}",
-		id)
+	cmd := exec.Command("podman", "ps", "--all", "--filter", "label="+key, "--format", "json")
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+
+	log.Printf("Listing containers with label %s", key)
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("Error: %s\n\nStderr: %s", err, stderr.String()) //nolint:staticcheck
+		return nil, fmt.Errorf("Error listing containers: %s\n\nStderr: %s", err, stderr.String()) //nolint:staticcheck
 	}
 
-	return strings.TrimSpace(stdout.String()), nil
+	var containers []struct {
+		Id     string
+		Labels map[string]string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &containers); err != nil {
+		return nil, fmt.Errorf("Error parsing the containers: %s", err) //nolint:staticcheck
+	}
+
+	result := make(map[string]string, len(containers))
+	for _, c := range containers {
+		result[c.Id] = c.Labels[key]
+	}
+	return result, nil
 }
 
-func (d *PodmanDriver) Entrypoint(id string) (string, error) {
+// inspect decodes the JSON output of the format template applied to the
+// given object of the given type, image or container.
+func (d *PodmanDriver) inspect(kind string, id string, format string, v interface{}) error {
 	var stderr, stdout bytes.Buffer
 	cmd := exec.Command(
 		"podman",
 		"inspect",
+		"--type",
+		kind,
 		"--format",
-		"{{if .Config.Entrypoint}} {{json .Config.Entrypoint}} {{else}} [] {{end}}",
+		format,
 		id)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("Error: %s\n\nStderr: %s", err, stderr.String()) //nolint:staticcheck
+		return fmt.Errorf("Error: %s\n\nStderr: %s", err, stderr.String()) //nolint:staticcheck
 	}
 
-	return strings.TrimSpace(stdout.String()), nil
-}
+	if err := json.Unmarshal(stdout.Bytes(), v); err != nil {
+		return fmt.Errorf("Error decoding %s of image %s: %s", format, id, err) //nolint:staticcheck
+	}
 
-func (d *PodmanDriver) Login(repo, user, pass string) error {
-	d.l.Lock()
+	return nil
+}
 
-	version_running, err := d.Version()
-	if err != nil {
-		d.l.Unlock()
-		return err
-	}
+// run runs podman with the given arguments, returning its stderr in the error
+// if it fails.
+func (d *PodmanDriver) run(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("podman", args...)
+	cmd.Stderr = &stderr
 
-	// Version 17.07.0 of Podman adds support for the new
-	// `--password-stdin` option which can be used to offer
-	// password via the standard input, rather than passing
-	// the password and/or token using a command line switch.
-	constraint, err := version.NewConstraint(">= 17.07.0")
-	if err != nil {
-		d.l.Unlock()
-		return err
+	log.Printf("Executing: podman %v", args)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error running podman %s: %s\n\nStderr: %s", args[0], err, stderr.String()) //nolint:staticcheck
 	}
 
-	cmd := exec.Command("podman")
-	cmd.Args = append(cmd.Args, "login")
+	return nil
+}
 
-	if user != "" {
-		cmd.Args = append(cmd.Args, "-u", user)
+func (d *PodmanDriver) Login(config *LoginConfig) error {
+	cmd := exec.Command("podman", "login")
+	cmd.Args = append(cmd.Args, authFileArgs(config.AuthFile)...)
+	if config.SkipTLSVerify {
+		cmd.Args = append(cmd.Args, "--tls-verify=false")
+	}
+	if config.CertDir != "" {
+		cmd.Args = append(cmd.Args, "--cert-dir", config.CertDir)
+	}
+	if config.Username != "" {
+		cmd.Args = append(cmd.Args, "--username", config.Username)
 	}
 
-	if pass != "" {
-		if constraint.Check(version_running) {
-			cmd.Args = append(cmd.Args, "--password-stdin")
-
-			stdin, err := cmd.StdinPipe()
-			if err != nil {
-				d.l.Unlock()
-				return err
-			}
-			_, err = io.WriteString(stdin, pass)
-			if err != nil {
-				return err
-			}
-			stdin.Close() //nolint:errcheck
-		} else {
-			cmd.Args = append(cmd.Args, "-p", pass)
-		}
+	// The password is only ever given on the standard input, which is read
+	// once the command started, so it isn't on the command line. It is also
+	// scrubbed from the log, but not from the output shown in the UI.
+	if config.Password != "" {
+		cmd.Args = append(cmd.Args, "--password-stdin")
+		cmd.Stdin = strings.NewReader(config.Password)
 	}
 
-	if repo != "" {
-		cmd.Args = append(cmd.Args, repo)
+	if config.Server != "" {
+		cmd.Args = append(cmd.Args, config.Server)
 	}
 
-	err = runAndStream(cmd, d.Ui)
-	if err != nil {
-		d.l.Unlock()
-		return err
+	return localexec.RunAndStream(cmd, d.Ui, []string{config.Password})
+}
+
+func (d *PodmanDriver) Logs(ctx context.Context, id string, dst io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "podman", "logs", "--follow", id)
+	// The container output is mixed in a single stream, like a terminal
+	// would show it. Both are copied to it at the same time.
+	out := &lockedWriter{w: dst}
+	cmd.Stdout = out
+	cmd.Stderr = io.MultiWriter(out, &stderr)
+
+	// Following the logs is stopped by killing podman, which isn't an error.
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		//nolint:staticcheck
+		return fmt.Errorf("Error reading logs: %s\nStderr: %s", err, stderr.String())
 	}
 
 	return nil
 }
 
-func (d *PodmanDriver) Logout(repo string) error {
-	args := []string{"logout"}
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Write(p)
+}
+
+func (d *PodmanDriver) Logout(repo, authfile string) error {
+	args := append([]string{"logout"}, authFileArgs(authfile)...)
 	if repo != "" {
 		args = append(args, repo)
 	}
 
 	cmd := exec.Command("podman", args...)
-	err := runAndStream(cmd, d.Ui)
-	d.l.Unlock()
-	return err
+	return runAndStream(cmd, d.Ui)
 }
 
-func (d *PodmanDriver) Pull(image string) error {
-	cmd := exec.Command("podman", "pull", image)
+func (d *PodmanDriver) Pull(image, policy, authfile string) error {
+	args := []string{"pull"}
+	// always is the default policy
+	if policy != "always" {
+		args = append(args, "--policy", policy)
+	}
+	args = append(args, authFileArgs(authfile)...)
+	cmd := exec.Command("podman", append(args, image)...)
 	return runAndStream(cmd, d.Ui)
 }
 
-func (d *PodmanDriver) Push(name string) error {
-	cmd := exec.Command("podman", "push", name)
+func (d *PodmanDriver) Push(name, authfile string) error {
+	args := append([]string{"push"}, authFileArgs(authfile)...)
+	cmd := exec.Command("podman", append(args, name)...)
 	return runAndStream(cmd, d.Ui)
 }
 
+// authFileArgs returns the podman arguments reading the credentials from the
+// auth file, if not empty, rather than from the auth file of the user.
+func authFileArgs(authfile string) []string {
+	if authfile == "" {
+		return nil
+	}
+	return []string{"--authfile", authfile}
+}
+
 func (d *PodmanDriver) SaveImage(id string, dst io.Writer) error {
 	var stderr bytes.Buffer
 	cmd := exec.Command("podman", "save", id)
@@ -331,6 +489,13 @@ func (d *PodmanDriver) StartContainer(config *ContainerConfig) (string, error) {
 
 	// Args that we're going to pass to Podman
 	args := []string{"run"}
+	if config.Name != "" {
+		args = append(args, "--name", config.Name)
+	}
+	if config.Replace {
+		args = append(args, "--replace")
+	}
+	args = append(args, authFileArgs(config.AuthFile)...)
 	for _, v := range config.Device {
 		args = append(args, "--device", v)
 	}
@@ -347,8 +512,16 @@ func (d *PodmanDriver) StartContainer(config *ContainerConfig) (string, error) {
 	for _, v := range config.TmpFs {
 		args = append(args, "--tmpfs", v)
 	}
-	for host, guest := range config.Volumes {
-		args = append(args, "-v", fmt.Sprintf("%s:%s", host, guest))
+	for _, v := range config.Mounts {
+		args = append(args, "--mount", v.String())
+	}
+	labels := make([]string, 0, len(config.Labels))
+	for k, v := range config.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	for _, v := range labels {
+		args = append(args, "--label", v)
 	}
 	for _, v := range config.RunCommand {
 		v, err := interpolate.Render(v, &ictx)
@@ -387,53 +560,100 @@ func (d *PodmanDriver) StartContainer(config *ContainerConfig) (string, error) {
 	return strings.TrimSpace(stdout.String()), nil
 }
 
-func (d *PodmanDriver) StopContainer(id string) error {
-	if err := exec.Command("podman", "stop", id).Run(); err != nil {
-		return err
+func (d *PodmanDriver) PauseContainer(id string) error {
+	return d.run("pause", id)
+}
+
+func (d *PodmanDriver) PathInImage(image string, path string) (bool, error) {
+	// The test exits with 1 when the path doesn't exist, anything else is an
+	// error of podman.
+	script := `root=$(podman image mount "$1") || exit 2; test -e "$root$2" || test -L "$root$2"; status=$?; podman image umount "$1" >/dev/null; exit $status`
+	args := unshareArgs("sh", "-c", script, "sh", image, path)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = &stderr
+
+	log.Printf("Executing: %v", args)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
 	}
-	return nil
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("Error looking for %s in the image: %s\n\nStderr: %s", path, err, stderr.String()) //nolint:staticcheck
 }
 
-func (d *PodmanDriver) KillContainer(id string) error {
-	if err := exec.Command("podman", "kill", id).Run(); err != nil {
-		return err
+func (d *PodmanDriver) RemoveMountPoint(id string, dir string) error {
+	// The directory is removed from the filesystem of the container as
+	// mounted on the host, where nothing is mounted on it. Since Linux 3.18
+	// this detaches the volume in the mount namespace of the container.
+	// Rootless podman only mounts containers in its user namespace.
+	script := `root=$(podman mount "$1") || exit; rmdir -- "$root$2"; status=$?; podman umount "$1" >/dev/null; exit $status`
+	args := unshareArgs("sh", "-c", script, "sh", id, dir)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = &stderr
+
+	log.Printf("Executing: %v", args)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error removing mount point %s: %s\n\nStderr: %s", dir, err, stderr.String()) //nolint:staticcheck
 	}
 
-	return exec.Command("podman", "rm", id).Run()
+	return nil
 }
 
-func (d *PodmanDriver) TagImage(id string, repo string, force bool) error {
-	args := []string{"tag"}
+// unshareArgs returns the command running the arguments in the user namespace
+// of rootless podman, where it mounts the containers and images.
+func unshareArgs(args ...string) []string {
+	if os.Geteuid() != 0 {
+		return append([]string{"podman", "unshare"}, args...)
+	}
+	return args
+}
 
-	// detect running podman version before tagging
-	// flag `force` for podman tagging was removed after Podman 1.12.0
-	// to keep its backward compatibility, we are not going to remove `force`
-	// option, but to ignore it when Podman version >= 1.12.0
-	//
-	// for more detail, please refer to the following links:
-	// - https://docs.podman.com/engine/deprecated/#/f-flag-on-podman-tag
-	// - https://github.com/podman/podman/pull/23090
-	version_running, err := d.Version()
-	if err != nil {
-		return err
+func (d *PodmanDriver) StopContainer(id string, signal string, timeout time.Duration) error {
+	if signal == "" {
+		// podman stop waits for the container to exit, and kills it after
+		// the timeout. It also succeeds if the container already exited.
+		seconds := strconv.Itoa(int(timeout.Round(time.Second).Seconds()))
+		return d.run("stop", "--time", seconds, id)
 	}
 
-	version_deprecated, err := version.NewVersion("1.12.0")
-	if err != nil {
-		// should never reach this line
+	// podman stop would send the stop signal of the container right after
+	// the given one, so the container is given the timeout to exit before
+	// it is stopped, like systemd which re-executes itself on SIGTERM.
+	if err := d.run("kill", "--signal", signal, id); err != nil {
 		return err
 	}
 
-	if force {
-		if version_running.LessThan(version_deprecated) {
-			args = append(args, "-f")
-		} else {
-			// do nothing if Podman version >= 1.12.0
-			log.Printf("[WARN] option: \"force\" will be ignored here")
-			log.Printf("since it was removed after Podman 1.12.0 released")
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "podman", "wait", id)
+	log.Printf("Executing: podman wait %s", id)
+	if err := cmd.Run(); err == nil {
+		return nil
+	} else if ctx.Err() == nil {
+		return fmt.Errorf("Error waiting for the container to exit: %s", err) //nolint:staticcheck
 	}
-	args = append(args, id, repo)
+
+	log.Printf("Container %s still running after %s, killing it", id, timeout)
+	return d.run("stop", "--time", "0", id)
+}
+
+func (d *PodmanDriver) UnpauseContainer(id string) error {
+	return d.run("unpause", id)
+}
+
+func (d *PodmanDriver) KillContainer(id string) error {
+	return d.run("rm", "--force", "--ignore", "--time", "0", id)
+}
+
+func (d *PodmanDriver) TagImage(id string, repo string) error {
+	args := []string{"tag", id, repo}
 
 	var stderr bytes.Buffer
 	cmd := exec.Command("podman", args...)
@@ -458,19 +678,53 @@ func (d *PodmanDriver) Verify() error {
 		return err
 	}
 
-	return nil
+	caps, err := d.Capabilities()
+	if err != nil {
+		return err
+	}
+	log.Printf("Podman %s (server %s), rootless: %t, cgroups v%d, OCI runtime: %s",
+		caps.ClientVersion, caps.ServerVersion, caps.Rootless, caps.CgroupVersion, caps.OCIRuntime)
+
+	return caps.Supported()
 }
 
-func (d *PodmanDriver) Version() (*version.Version, error) {
-	output, err := exec.Command("podman", "-v").Output()
+func (d *PodmanDriver) Capabilities() (*Capabilities, error) {
+	d.capsOnce.Do(func() {
+		var versionJSON, infoJSON []byte
+		versionJSON, d.capsErr = d.output("version", "--format", "json")
+		if d.capsErr != nil {
+			return
+		}
+		infoJSON, d.capsErr = d.output("info", "--format", "json")
+		if d.capsErr != nil {
+			return
+		}
+		d.caps, d.capsErr = parseCapabilities(versionJSON, infoJSON)
+	})
+
+	return d.caps, d.capsErr
+}
+
+// output runs podman and returns its output, capturing stderr for errors.
+func (d *PodmanDriver) output(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("podman", args...)
+	cmd.Stderr = &stderr
+
+	log.Printf("Executing: podman %v", args)
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Error running podman %s: %s\n\nStderr: %s", args[0], err, stderr.String()) //nolint:staticcheck
 	}
 
-	match := regexp.MustCompile(version.VersionRegexpRaw).FindSubmatch(output)
-	if match == nil {
-		return nil, fmt.Errorf("unknown version: %s", output) //nolint:staticcheck
+	return output, nil
+}
+
+func (d *PodmanDriver) Version() (*version.Version, error) {
+	caps, err := d.Capabilities()
+	if err != nil {
+		return nil, err
 	}
 
-	return version.NewVersion(string(match[0]))
+	return caps.ClientVersion, nil
 }
@@ -0,0 +1,345 @@
+package podman
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// testFakePodman puts a podman script first in the PATH, which appends its
+// arguments to args.txt and records its standard input in stdin.txt, and
+// returns the directory holding them. The output of a subcommand is read from
+// <subcommand>.json in that directory, if it exists, or is the one of the
+// <subcommand>.sh script, and it sleeps for the duration in
+// <subcommand>.sleep first. podman unshare runs its command.
+func testFakePodman(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake podman is a shell script")
+	}
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"dir=$(dirname \"$0\")\n" +
+		"echo \"$@\" >> \"$dir/args.txt\"\n" +
+		"if [ \"$1\" = unshare ]; then shift; exec \"$@\"; fi\n" +
+		"[ -f \"$dir/$1.sleep\" ] && exec sleep \"$(cat \"$dir/$1.sleep\")\"\n" +
+		"[ -f \"$dir/$1.json\" ] && exec cat \"$dir/$1.json\"\n" +
+		"[ -f \"$dir/$1.sh\" ] && exec sh \"$dir/$1.sh\"\n" +
+		"cat > \"$dir/stdin.txt\"\n" +
+		"echo 'Login Succeeded!'\n"
+	if err := os.WriteFile(filepath.Join(dir, "podman"), []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestPodmanDriver_Login(t *testing.T) {
+	dir := testFakePodman(t)
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+
+	err := driver.Login(&LoginConfig{
+		Server:        "registry.example.com",
+		Username:      "user",
+		Password:      "s3cret",
+		AuthFile:      "/tmp/auth.json",
+		SkipTLSVerify: true,
+		CertDir:       "/etc/certs",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := "login --authfile /tmp/auth.json --tls-verify=false --cert-dir /etc/certs " +
+		"--username user --password-stdin registry.example.com\n"
+	if string(args) != expected {
+		t.Fatalf("bad args: %q", args)
+	}
+	if strings.Contains(string(args), "s3cret") {
+		t.Fatal("password shouldn't be on the command line")
+	}
+
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin.txt"))
+	if err != nil || string(stdin) != "s3cret" {
+		t.Fatalf("bad stdin: %q %v", stdin, err)
+	}
+}
+
+func TestPodmanDriver_Verify(t *testing.T) {
+	dir := testFakePodman(t)
+	info := `{"host":{"cgroupVersion":"v2","ociRuntime":{"name":"crun"},"security":{"rootless":true}}}`
+	if err := os.WriteFile(filepath.Join(dir, "info.json"), []byte(info), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for v, supported := range map[string]bool{"4.9.3": true, "2.2.1": false} {
+		if err := os.WriteFile(filepath.Join(dir, "version.json"), []byte(`{"Client":{"Version":"`+v+`"}}`), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+		err := driver.Verify()
+		if supported != (err == nil) {
+			t.Fatalf("%s: bad: %v", v, err)
+		}
+
+		caps, err := driver.Capabilities()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if caps.ClientVersion.String() != v || !caps.Rootless || caps.CgroupVersion != 2 || caps.OCIRuntime != "crun" {
+			t.Fatalf("bad capabilities: %#v", caps)
+		}
+		if version, err := driver.Version(); err != nil || version.String() != v {
+			t.Fatalf("bad version: %s %v", version, err)
+		}
+	}
+}
+
+func TestPodmanDriver_StopContainer(t *testing.T) {
+	// Without a signal, podman stop handles the timeout
+	dir := testFakePodman(t)
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+	if err := driver.StopContainer("foo", "", 10*time.Second); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testFakePodmanArgs(t, dir, "stop --time 10 foo")
+
+	// The container exits on the signal within the timeout
+	dir = testFakePodman(t)
+	if err := driver.StopContainer("foo", "SIGRTMIN+3", 10*time.Second); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testFakePodmanArgs(t, dir, "kill --signal SIGRTMIN+3 foo", "wait foo")
+
+	// The container is stopped without grace once the timeout expired
+	dir = testFakePodman(t)
+	if err := os.WriteFile(filepath.Join(dir, "wait.sleep"), []byte("10"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	start := time.Now()
+	if err := driver.StopContainer("foo", "SIGRTMIN+3", 200*time.Millisecond); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("should have stopped waiting after the timeout: %s", elapsed)
+	}
+	testFakePodmanArgs(t, dir, "kill --signal SIGRTMIN+3 foo", "wait foo", "stop --time 0 foo")
+}
+
+func TestPodmanDriver_Exec(t *testing.T) {
+	dir := testFakePodman(t)
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+	if _, err := driver.Exec(context.Background(), "foo", []string{"true"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testFakePodmanArgs(t, dir, "exec foo true")
+
+	// A hanging command is killed when the context is done
+	dir = testFakePodman(t)
+	if err := os.WriteFile(filepath.Join(dir, "exec.sleep"), []byte("10"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := driver.Exec(ctx, "foo", []string{"sleep", "infinity"}); err == nil {
+		t.Fatal("should have error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("should have been killed after the timeout: %s", elapsed)
+	}
+}
+
+func TestPodmanDriver_Logs(t *testing.T) {
+	// Following the logs until the container exits
+	dir := testFakePodman(t)
+	if err := os.WriteFile(filepath.Join(dir, "logs.sh"), []byte("echo out; echo err >&2\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+	var logs bytes.Buffer
+	if err := driver.Logs(context.Background(), "foo", &logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, expected := range []string{"out\n", "err\n"} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Fatalf("logs should contain %q: %#v", expected, logs.String())
+		}
+	}
+	testFakePodmanArgs(t, dir, "logs --follow foo")
+
+	// Stopping to follow them isn't an error
+	dir = testFakePodman(t)
+	if err := os.WriteFile(filepath.Join(dir, "logs.sleep"), []byte("10"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := driver.Logs(ctx, "foo", io.Discard); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("should have stopped following the logs: %s", elapsed)
+	}
+}
+
+// testFakePodmanArgs checks the commands run by the fake podman.
+func testFakePodmanArgs(t *testing.T, dir string, expected ...string) {
+	t.Helper()
+	args, err := os.ReadFile(filepath.Join(dir, "args.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := strings.Split(strings.TrimSpace(string(args)), "\n"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad commands: %#v", actual)
+	}
+}
+
+func TestPodmanDriver_Pull(t *testing.T) {
+	dir := testFakePodman(t)
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+
+	if err := driver.Pull("fedora", "always", ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := driver.Pull("fedora", "newer", "/tmp/auth.json"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testFakePodmanArgs(t, dir, "pull fedora", "pull --policy newer --authfile /tmp/auth.json fedora")
+}
+
+// testFakePodmanRootfs makes the fake podman mount and export the containers
+// from a rootfs directory holding /packer-files, /etc/hostname and
+// /var/cache/dnf/packages, and returns it.
+func testFakePodmanRootfs(t *testing.T, dir string) string {
+	rootfs := t.TempDir()
+	for _, d := range []string{"packer-files", "etc", "var/cache/dnf"} {
+		if err := os.MkdirAll(filepath.Join(rootfs, d), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	for name, data := range map[string]string{"etc/hostname": "web\n", "var/cache/dnf/packages": "cached"} {
+		if err := os.WriteFile(filepath.Join(rootfs, name), []byte(data), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "mount.json"), []byte(rootfs+"\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	export := fmt.Sprintf("exec tar -C '%s' -cf - .\n", rootfs)
+	if err := os.WriteFile(filepath.Join(dir, "export.sh"), []byte(export), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return rootfs
+}
+
+func TestPodmanDriver_PathInImage(t *testing.T) {
+	dir := testFakePodman(t)
+	rootfs := t.TempDir()
+	if err := os.Mkdir(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "image.json"), []byte(rootfs+"\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+
+	for path, expected := range map[string]bool{"/etc": true, "/packer-files": false} {
+		inImage, err := driver.PathInImage("foo", path)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if inImage != expected {
+			t.Fatalf("bad result for %s: %t", path, inImage)
+		}
+	}
+
+	// The image is mounted in the user namespace of rootless podman
+	args := strings.Split(strings.TrimSpace(testReadFile(t, dir, "args.txt")), "\n")
+	if os.Geteuid() != 0 {
+		var mounts []string
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "unshare sh -c ") {
+				mounts = append(mounts, arg)
+			}
+		}
+		args = mounts
+	}
+	if expected := []string{"image mount foo", "image umount foo", "image mount foo", "image umount foo"}; !reflect.DeepEqual(args, expected) {
+		t.Fatalf("bad commands: %#v", args)
+	}
+
+	// Failing to mount the image isn't mistaken for a missing path
+	if err := os.Remove(filepath.Join(dir, "image.json")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "image.sh"), []byte("echo 'image not known' >&2; exit 125\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := driver.PathInImage("foo", "/etc"); err == nil || !strings.Contains(err.Error(), "image not known") {
+		t.Fatalf("should error: %v", err)
+	}
+}
+
+func TestPodmanDriver_RemoveMountPoint(t *testing.T) {
+	dir := testFakePodman(t)
+	rootfs := testFakePodmanRootfs(t, dir)
+	driver := &PodmanDriver{Ui: packersdk.TestUi(t)}
+
+	if err := driver.RemoveMountPoint("foo", "/packer-files"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, "packer-files")); !os.IsNotExist(err) {
+		t.Fatalf("mount point should be removed: %v", err)
+	}
+
+	// A directory of the image that isn't empty is kept, and the container
+	// is unmounted anyway
+	if err := driver.RemoveMountPoint("foo", "/etc"); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "etc", "hostname")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Rootless podman only mounts containers in its user namespace
+	args := strings.Split(strings.TrimSpace(testReadFile(t, dir, "args.txt")), "\n")
+	if os.Geteuid() != 0 {
+		var mounts []string
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "unshare sh -c ") {
+				mounts = append(mounts, arg)
+			}
+		}
+		args = mounts
+	}
+	if expected := []string{"mount foo", "umount foo", "mount foo", "umount foo"}; !reflect.DeepEqual(args, expected) {
+		t.Fatalf("bad commands: %#v", args)
+	}
+}
+
+func testReadFile(t *testing.T, dir string, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return string(data)
+}
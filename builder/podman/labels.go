@@ -0,0 +1,87 @@
+package podman
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	podmanVersion "packer-plugin-podman/version"
+)
+
+const (
+	// ownerLabel is set on the build containers to find the ones left behind
+	// by builds that didn't clean up. Its value is the host and PID of the
+	// plugin process that started the container, like `myhost:1234`.
+	ownerLabel = "io.packer.podman.owner"
+
+	buildNameLabel     = "io.packer.build-name"
+	runUUIDLabel       = "io.packer.run-uuid"
+	pluginVersionLabel = "io.packer.podman.version"
+
+	// OCI annotations stamped on the committed image, see
+	// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+	createdLabel  = "org.opencontainers.image.created"
+	baseNameLabel = "org.opencontainers.image.base.name"
+)
+
+// owner returns the value of ownerLabel for the containers of this process.
+func owner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// buildLabels returns the labels identifying the Packer build, merged with
+// the labels given by the user, which take precedence.
+func buildLabels(config *Config) map[string]string {
+	labels := map[string]string{
+		pluginVersionLabel: podmanVersion.PluginVersion.String(),
+	}
+	if config.PackerBuildName != "" {
+		labels[buildNameLabel] = config.PackerBuildName
+	}
+	// Packer core passes the UUID of the run to the plugins in the
+	// environment rather than in the PackerConfig.
+	if uuid := os.Getenv("PACKER_RUN_UUID"); uuid != "" {
+		labels[runUUIDLabel] = uuid
+	}
+
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// containerLabels returns the labels of the build container.
+func containerLabels(config *Config) map[string]string {
+	labels := buildLabels(config)
+	labels[ownerLabel] = owner()
+	return labels
+}
+
+// imageLabelChanges returns the LABEL changes stamping the committed image
+// with the build labels and the OCI annotations. The owner label of the build
+// container is emptied, so that containers run from the image aren't mistaken
+// for orphaned build containers.
+func imageLabelChanges(config *Config, created time.Time) []string {
+	labels := map[string]string{
+		createdLabel:  created.UTC().Format(time.RFC3339),
+		baseNameLabel: config.Image,
+	}
+	for k, v := range buildLabels(config) {
+		labels[k] = v
+	}
+	labels[ownerLabel] = ""
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	changes := make([]string, 0, len(keys))
+	for _, k := range keys {
+		changes = append(changes, fmt.Sprintf("LABEL %s=%s", k, quoteValue(labels[k])))
+	}
+	return changes
+}
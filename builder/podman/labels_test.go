@@ -0,0 +1,55 @@
+package podman
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	podmanVersion "packer-plugin-podman/version"
+)
+
+func TestContainerLabels(t *testing.T) {
+	t.Setenv("PACKER_RUN_UUID", "1234")
+	config := testConfigStruct(t)
+	config.PackerBuildName = "web"
+	config.Labels = map[string]string{"team": "ops"}
+
+	expected := map[string]string{
+		ownerLabel:         owner(),
+		buildNameLabel:     "web",
+		runUUIDLabel:       "1234",
+		pluginVersionLabel: podmanVersion.PluginVersion.String(),
+		"team":             "ops",
+	}
+	if labels := containerLabels(config); !reflect.DeepEqual(labels, expected) {
+		t.Fatalf("bad labels: %#v", labels)
+	}
+}
+
+func TestImageLabelChanges(t *testing.T) {
+	t.Setenv("PACKER_RUN_UUID", "")
+	config := testConfigStruct(t)
+	config.Image = "fedora:40"
+	config.Labels = map[string]string{
+		"org.opencontainers.image.source": "https://example.com/repo",
+		createdLabel:                      "yesterday at noon",
+	}
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expected := []string{
+		`LABEL io.packer.podman.owner=""`,
+		"LABEL io.packer.podman.version=" + podmanVersion.PluginVersion.String(),
+		"LABEL org.opencontainers.image.base.name=fedora:40",
+		`LABEL org.opencontainers.image.created="yesterday at noon"`,
+		"LABEL org.opencontainers.image.source=https://example.com/repo",
+	}
+	if changes := imageLabelChanges(config, created); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("bad changes: %#v", changes)
+	}
+
+	delete(config.Labels, createdLabel)
+	changes := imageLabelChanges(config, created)
+	if changes[3] != "LABEL org.opencontainers.image.created=2024-05-01T12:00:00Z" {
+		t.Fatalf("bad created: %s", changes[3])
+	}
+}
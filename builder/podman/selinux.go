@@ -0,0 +1,21 @@
+package podman
+
+import (
+	"os"
+	"strings"
+)
+
+// selinuxEnforcePath is the file exposing the SELinux mode of the host. It is
+// a variable so that tests can point it somewhere else.
+var selinuxEnforcePath = "/sys/fs/selinux/enforce"
+
+// selinuxEnforcing reports whether SELinux is enabled and enforcing on the
+// host. Hosts without SELinux are reported as not enforcing.
+func selinuxEnforcing() bool {
+	b, err := os.ReadFile(selinuxEnforcePath)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(b)) == "1"
+}
@@ -0,0 +1,63 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCleanup scrubs the container through the communicator before it is
+// committed or exported, according to the cleanup_paths and cleanup_profiles
+// options, and removes the mount point of the temp dir.
+type StepCleanup struct{}
+
+func (s *StepCleanup) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining podman config") //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	driver := state.Get("driver").(Driver)
+	containerId := state.Get("container_id").(string)
+
+	if script := cleanupScript(config); script != "" {
+		comm := state.Get("communicator").(packersdk.Communicator)
+
+		ui.Say("Cleaning up the container")
+		cmd := &packersdk.RemoteCmd{Command: script}
+		err := cmd.RunWithUi(ctx, comm, ui)
+		if err == nil && cmd.ExitStatus() != 0 {
+			err = fmt.Errorf("exit status %d", cmd.ExitStatus())
+		}
+		if err != nil {
+			err := fmt.Errorf("Error cleaning up the container: %s", err) //nolint:staticcheck
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	// The temp dir is mounted on container_dir, which podman created in the
+	// container unless the image has it. Nothing is uploaded anymore, so the
+	// directory podman created is removed to keep it out of the image. It
+	// isn't fatal, as the provisioners may have written to it.
+	inImage, err := driver.PathInImage(config.Image, config.ContainerDir)
+	switch {
+	case err != nil:
+		ui.Message(fmt.Sprintf("Keeping the mount point %s: %s", config.ContainerDir, err))
+	case !inImage:
+		if err := driver.RemoveMountPoint(containerId, config.ContainerDir); err != nil {
+			ui.Message(fmt.Sprintf("Couldn't remove the mount point %s: %s", config.ContainerDir, err))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCleanup) Cleanup(state multistep.StateBag) {}
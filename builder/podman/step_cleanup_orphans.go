@@ -0,0 +1,104 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCleanupOrphans looks for the containers of earlier builds on this host
+// whose process is gone, and removes them if cleanup_orphans is set.
+type StepCleanupOrphans struct{}
+
+func (s *StepCleanupOrphans) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining podman config") //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	driver := state.Get("driver").(Driver)
+
+	containers, err := driver.ContainersByLabel(ownerLabel)
+	if err != nil {
+		// Not being able to look for orphans shouldn't fail the build
+		log.Printf("[WARN] Error looking for orphaned containers: %s", err)
+		return multistep.ActionContinue
+	}
+
+	hostname, _ := os.Hostname()
+	var orphans []string
+	for id, value := range containers {
+		if isOrphan(value, hostname) {
+			orphans = append(orphans, id)
+		}
+	}
+	if len(orphans) == 0 {
+		return multistep.ActionContinue
+	}
+	sort.Strings(orphans)
+
+	if !config.CleanupOrphans {
+		ui.Say(fmt.Sprintf("Found containers left behind by earlier builds: %s\n"+
+			"Remove them with `podman rm -f %s`, or set cleanup_orphans to remove them automatically.",
+			strings.Join(orphans, ", "), strings.Join(orphans, " ")))
+		return multistep.ActionContinue
+	}
+
+	for _, id := range orphans {
+		ui.Say(fmt.Sprintf("Removing container left behind by an earlier build: %s", id))
+		if err := driver.KillContainer(id); err != nil {
+			ui.Error(fmt.Sprintf("Error removing the container %s: %s", id, err))
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCleanupOrphans) Cleanup(state multistep.StateBag) {}
+
+// isOrphan returns true if the owner label value belongs to a process of this
+// host that is no longer running. Containers of other hosts sharing the same
+// podman service are never considered orphaned.
+func isOrphan(value string, hostname string) bool {
+	i := strings.LastIndex(value, ":")
+	if i < 0 || value[:i] != hostname {
+		return false
+	}
+	pid, err := strconv.Atoi(value[i+1:])
+	if err != nil {
+		return false
+	}
+
+	return !processAlive(pid)
+}
+
+// processAlive returns true if a process with the given PID is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess already fails for processes that don't exist
+		return true
+	}
+
+	// Signal 0 only checks that the process exists. EPERM means it belongs
+	// to another user.
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
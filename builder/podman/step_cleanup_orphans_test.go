@@ -0,0 +1,91 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// deadPid returns the PID of a process that exited.
+func deadPid(t *testing.T) int {
+	cmd := exec.Command("go", "version")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return cmd.Process.Pid
+}
+
+func testOrphans(t *testing.T) map[string]string {
+	hostname, _ := os.Hostname()
+	return map[string]string{
+		"alive":  owner(),
+		"dead":   fmt.Sprintf("%s:%d", hostname, deadPid(t)),
+		"remote": fmt.Sprintf("%s-other:%d", hostname, deadPid(t)),
+		"bad":    "foo",
+	}
+}
+
+func TestStepCleanupOrphans_impl(t *testing.T) {
+	var _ multistep.Step = new(StepCleanupOrphans)
+}
+
+func TestStepCleanupOrphans(t *testing.T) {
+	state := testState(t)
+	step := new(StepCleanupOrphans)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.CleanupOrphans = true
+	driver := state.Get("driver").(*MockDriver)
+	driver.ContainersByLabelResult = testOrphans(t)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	if driver.ContainersByLabelKey != ownerLabel {
+		t.Fatalf("bad label: %s", driver.ContainersByLabelKey)
+	}
+	if !reflect.DeepEqual(driver.KillIDs, []string{"dead"}) {
+		t.Fatalf("bad removed containers: %#v", driver.KillIDs)
+	}
+}
+
+func TestStepCleanupOrphans_report(t *testing.T) {
+	state := testState(t)
+	step := new(StepCleanupOrphans)
+	defer step.Cleanup(state)
+
+	driver := state.Get("driver").(*MockDriver)
+	driver.ContainersByLabelResult = testOrphans(t)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	if driver.KillCalled {
+		t.Fatal("shouldn't have removed containers")
+	}
+}
+
+func TestStepCleanupOrphans_error(t *testing.T) {
+	state := testState(t)
+	step := new(StepCleanupOrphans)
+	defer step.Cleanup(state)
+
+	driver := state.Get("driver").(*MockDriver)
+	driver.ContainersByLabelErr = errors.New("foo")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); ok {
+		t.Fatal("shouldn't have error")
+	}
+}
@@ -0,0 +1,175 @@
+package podman
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func testStepCleanupState(t *testing.T) (multistep.StateBag, *packersdk.MockCommunicator) {
+	state := testState(t)
+	comm := new(packersdk.MockCommunicator)
+	state.Put("communicator", comm)
+	state.Put("container_id", "foo")
+	return state, comm
+}
+
+func TestStepCleanup_impl(t *testing.T) {
+	var _ multistep.Step = new(StepCleanup)
+}
+
+func TestStepCleanup(t *testing.T) {
+	state, comm := testStepCleanupState(t)
+	step := new(StepCleanup)
+	defer step.Cleanup(state)
+
+	// Nothing to clean up
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if comm.StartCalled {
+		t.Fatal("shouldn't have run anything")
+	}
+
+	// The mount point of the temp dir is removed, as the image doesn't have it
+	driver := state.Get("driver").(*MockDriver)
+	config := state.Get("config").(*Config)
+	if !driver.PathInImageCalled || driver.PathInImageImage != config.Image || driver.PathInImagePath != "/packer-files" {
+		t.Fatalf("bad image lookup: %#v", driver)
+	}
+	if !driver.RemoveMountPointCalled || driver.RemoveMountPointID != "foo" || driver.RemoveMountPointDir != "/packer-files" {
+		t.Fatalf("bad mount point removal: %#v", driver)
+	}
+
+	config.CleanupPaths = []string{"/var/log/*.log"}
+	config.CleanupProfiles = []string{"apt"}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if !comm.StartCalled {
+		t.Fatal("should have run the cleanup")
+	}
+	if cmd := comm.StartCmd.Command; !strings.Contains(cmd, "apt-get clean") ||
+		!strings.HasSuffix(cmd, "rm -rf -- /var/log/*.log /var/lib/apt/lists/* /var/cache/apt/*.bin") {
+		t.Fatalf("bad command: %s", cmd)
+	}
+}
+
+func TestStepCleanup_failure(t *testing.T) {
+	state, comm := testStepCleanupState(t)
+	step := new(StepCleanup)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.CleanupPaths = []string{"/var/log/*.log"}
+	comm.StartExitStatus = 1
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+}
+
+func TestStepCleanup_mountPointError(t *testing.T) {
+	state, _ := testStepCleanupState(t)
+	step := new(StepCleanup)
+	defer step.Cleanup(state)
+
+	// The provisioners may have written to the directory, it is kept then
+	driver := state.Get("driver").(*MockDriver)
+	driver.RemoveMountPointErr = errors.New("directory not empty")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); ok {
+		t.Fatal("shouldn't have error")
+	}
+}
+
+func TestStepCleanup_mountPointInImage(t *testing.T) {
+	state, _ := testStepCleanupState(t)
+	step := new(StepCleanup)
+	defer step.Cleanup(state)
+
+	// The directory podman didn't create is kept, even if empty
+	driver := state.Get("driver").(*MockDriver)
+	driver.PathInImageResult = true
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if driver.RemoveMountPointCalled {
+		t.Fatal("shouldn't have removed the mount point")
+	}
+
+	// It is also kept when the image can't be inspected
+	driver.PathInImageResult = false
+	driver.PathInImageErr = errors.New("image not known")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if driver.RemoveMountPointCalled {
+		t.Fatal("shouldn't have removed the mount point")
+	}
+	if _, ok := state.GetOk("error"); ok {
+		t.Fatal("shouldn't have error")
+	}
+}
+
+func TestStepCleanup_exportedArtifact(t *testing.T) {
+	dir := testFakePodman(t)
+	testFakePodmanRootfs(t, dir)
+
+	state, _ := testStepCleanupState(t)
+	state.Put("driver", &PodmanDriver{Ui: state.Get("ui").(packersdk.Ui)})
+	config := state.Get("config").(*Config)
+	config.ExportPath = filepath.Join(t.TempDir(), "image.tar")
+	config.CleanupProfiles = []string{"dnf"}
+
+	for _, step := range []multistep.Step{new(StepCleanup), new(StepExport)} {
+		if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+			t.Fatalf("bad action: %#v %v", action, state.Get("error"))
+		}
+	}
+
+	f, err := os.Open(config.ExportPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		names = append(names, containerPath(hdr.Name))
+	}
+	sort.Strings(names)
+
+	// Neither the mount point of the temp dir nor the paths of the cleanup
+	// profiles are exported
+	expected := []string{"/", "/etc", "/etc/hostname", "/var", "/var/cache", "/var/cache/dnf"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bad export: %#v", names)
+	}
+}
@@ -3,6 +3,8 @@ package podman
 import (
 	"context"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -25,8 +27,19 @@ func (s *StepCommit) Run(ctx context.Context, state multistep.StateBag) multiste
 
 	driver := state.Get("driver").(Driver)
 	containerId := state.Get("container_id").(string)
-	ui.Say("Committing the container")
-	imageId, err := driver.Commit(containerId, config.Author, config.Changes, config.Message)
+
+	// The labels go first, so that the changes of the user override them
+	changes := append(imageLabelChanges(config, time.Now()), config.Changes...)
+
+	var imageId string
+	var err error
+	if config.Squash == "all" {
+		ui.Say("Committing the container as a single layer")
+		imageId, err = s.flatten(state, driver, containerId, changes)
+	} else {
+		ui.Say("Committing the container")
+		imageId, err = driver.Commit(containerId, config.Author, changes, config.Message, config.Squash == "new", config.Format)
+	}
 	if err != nil {
 		state.Put("error", err)
 		ui.Error(err.Error())
@@ -41,4 +54,28 @@ func (s *StepCommit) Run(ctx context.Context, state multistep.StateBag) multiste
 	return multistep.ActionContinue
 }
 
+// flatten exports the filesystem of the container and imports it back as a
+// single layer image, applying the changes to the new image. The paths of
+// cleanup_paths and cleanup_profiles are left out of the filesystem.
+func (s *StepCommit) flatten(state multistep.StateBag, driver Driver, containerId string, changes []string) (string, error) {
+	tempDir := state.Get("temp_dir").(string)
+
+	f, err := os.CreateTemp(tempDir, "squash-*.tar")
+	if err != nil {
+		return "", fmt.Errorf("Error creating squash file: %s", err) //nolint:staticcheck
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	config := state.Get("config").(*Config)
+	if err := exportFiltered(driver, containerId, f, pathFilter(cleanupPaths(config))); err != nil {
+		f.Close() //nolint:errcheck
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return driver.Import(f.Name(), changes, "")
+}
+
 func (s *StepCommit) Cleanup(state multistep.StateBag) {}
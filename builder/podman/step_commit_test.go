@@ -1,8 +1,12 @@
 package podman
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"os"
+	"reflect"
+	"slices"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -23,6 +27,7 @@ func TestStepCommit(t *testing.T) {
 	step := new(StepCommit)
 	defer step.Cleanup(state)
 
+	config := state.Get("config").(*Config)
 	driver := state.Get("driver").(*MockDriver)
 	driver.CommitImageId = "bar"
 
@@ -35,6 +40,12 @@ func TestStepCommit(t *testing.T) {
 	if !driver.CommitCalled {
 		t.Fatal("should've called")
 	}
+	if driver.CommitFormat != "oci" {
+		t.Fatalf("bad format: %#v", driver.CommitFormat)
+	}
+	if !slices.Contains(driver.CommitChanges, "LABEL org.opencontainers.image.base.name="+config.Image) {
+		t.Fatalf("bad changes: %#v", driver.CommitChanges)
+	}
 
 	// verify the ID is saved
 	idRaw, ok := state.GetOk("image_id")
@@ -66,3 +77,70 @@ func TestStepCommit_error(t *testing.T) {
 		t.Fatal("shouldn't save image ID")
 	}
 }
+
+func TestStepCommit_squashNew(t *testing.T) {
+	state := testStepCommitState(t)
+	step := new(StepCommit)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Squash = "new"
+	driver := state.Get("driver").(*MockDriver)
+	driver.CommitImageId = "bar"
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we squashed the new layers
+	if !driver.CommitCalled {
+		t.Fatal("should've called")
+	}
+	if !driver.CommitSquash {
+		t.Fatal("should've squashed")
+	}
+}
+
+func TestStepCommit_squashAll(t *testing.T) {
+	state := testStepCommitState(t)
+	state.Put("temp_dir", t.TempDir())
+	step := new(StepCommit)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Squash = "all"
+	config.Changes = []string{`CMD ["/bin/bash"]`}
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportReader = bytes.NewReader([]byte("data!"))
+	driver.ImportId = "bar"
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we went through export and import instead of commit
+	if driver.CommitCalled {
+		t.Fatal("shouldn't have committed")
+	}
+	if !driver.ExportCalled || driver.ExportID != "foo" {
+		t.Fatalf("should've exported the container: %#v", driver.ExportID)
+	}
+	if !driver.ImportCalled {
+		t.Fatal("should've imported")
+	}
+	// the changes of the user go last to override the labels
+	changes := driver.ImportChanges
+	if len(changes) == 0 || !reflect.DeepEqual(changes[len(changes)-1:], config.Changes) {
+		t.Fatalf("bad changes: %#v", driver.ImportChanges)
+	}
+
+	// verify the ID is saved and the export is removed
+	if id := state.Get("image_id").(string); id != "bar" {
+		t.Fatalf("bad: %#v", id)
+	}
+	if _, err := os.Stat(driver.ImportPath); err == nil {
+		t.Fatal("squash file should be removed")
+	}
+}
@@ -2,7 +2,11 @@ package podman
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 
@@ -10,7 +14,10 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
-// StepExport exports the container to a flat tar file.
+// StepExport exports the container to a flat tar file, compressed according to
+// export_compression, along with a sidecar file holding its SHA-256 checksum.
+// Other export formats unpack the export to a directory, and possibly make a
+// disk image from it.
 type StepExport struct{}
 
 func (s *StepExport) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -31,37 +38,224 @@ func (s *StepExport) Run(ctx context.Context, state multistep.StateBag) multiste
 		return multistep.ActionHalt
 	}
 
-	// Make the directory we're exporting to if it doesn't exist
-	exportDir := filepath.Dir(config.ExportPath)
-	if err := os.MkdirAll(exportDir, 0755); err != nil {
-		state.Put("error", err)
-		return multistep.ActionHalt
-	}
+	driver := state.Get("driver").(Driver)
+	containerId := state.Get("container_id").(string)
 
-	// Open the file that we're going to write to
-	f, err := os.Create(config.ExportPath)
+	var sum string
+	var err error
+	switch config.ExportFormat {
+	case "directory":
+		ui.Say(fmt.Sprintf("Exporting the container to the directory %s", config.ExportPath))
+		err = s.exportDirectory(driver, containerId, config)
+	case "tar":
+		if config.ExportCompression == "none" {
+			ui.Say("Exporting the container")
+		} else {
+			ui.Say(fmt.Sprintf("Exporting the container with %s compression", config.ExportCompression))
+		}
+		sum, err = s.export(driver, containerId, config)
+	default:
+		ui.Say(fmt.Sprintf("Exporting the container to a %s image", config.ExportFormat))
+		sum, err = s.exportDisk(driver, containerId, config)
+	}
 	if err != nil {
-		err := fmt.Errorf("Error creating output file: %s", err) //nolint:staticcheck
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
+	state.Put("export_path", config.ExportPath)
 
-	driver := state.Get("driver").(Driver)
-	containerId := state.Get("container_id").(string)
-
-	ui.Say("Exporting the container")
-	if err := driver.Export(containerId, f); err != nil {
-		f.Close()           //nolint:errcheck
-		os.Remove(f.Name()) //nolint:errcheck
+	if sum == "" {
+		return multistep.ActionContinue
+	}
 
+	// The checksum file uses the format of sha256sum, so that the export
+	// can be checked with `sha256sum -c`.
+	checksum := fmt.Sprintf("%s  %s\n", sum, filepath.Base(config.ExportPath))
+	if err := writeFileAtomic(config.ExportPath+".sha256", func(w io.Writer) error {
+		_, err := io.WriteString(w, checksum)
+		return err
+	}); err != nil {
+		err := fmt.Errorf("Error writing checksum file: %s", err) //nolint:staticcheck
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
-	f.Close() //nolint:errcheck
+	ui.Message(fmt.Sprintf("SHA-256: %s", sum))
+	state.Put("export_sha256", sum)
 	return multistep.ActionContinue
 }
 
+// export writes the compressed export of the container to export_path and
+// returns its SHA-256 checksum.
+func (s *StepExport) export(driver Driver, containerId string, config *Config) (string, error) {
+	// Make the directory we're exporting to if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(config.ExportPath), 0755); err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	err := writeFileAtomic(config.ExportPath, func(w io.Writer) error {
+		cw, err := compressWriter(io.MultiWriter(w, hash), config.ExportCompression, config.ExportCompressionLevel)
+		if err != nil {
+			return err
+		}
+		if err := exportFiltered(driver, containerId, cw, exportFilter(config)); err != nil {
+			cw.Close() //nolint:errcheck
+			return err
+		}
+		return cw.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// exportDirectory unpacks the export of the container to the export_path
+// directory. Like for files, the directory is only moved to export_path once
+// the export succeeded, and an existing directory is only replaced then.
+func (s *StepExport) exportDirectory(driver Driver, containerId string, config *Config) error {
+	_, err := os.Lstat(config.ExportPath)
+	exists := err == nil
+	if exists && !config.PackerForce {
+		return fmt.Errorf("Export directory %s already exists, use -force to replace it", config.ExportPath) //nolint:staticcheck
+	}
+
+	tempDir, err := s.unpack(driver, containerId, config)
+	if err != nil {
+		return err
+	}
+	defer removeAll(tempDir) //nolint:errcheck
+
+	if !exists {
+		return os.Rename(tempDir, config.ExportPath)
+	}
+
+	// Move the previous directory out of the way first, as a directory
+	// can't be renamed over another one, and back if the swap fails.
+	old := tempDir + ".old"
+	if err := os.Rename(config.ExportPath, old); err != nil {
+		return fmt.Errorf("Error replacing export directory: %s", err) //nolint:staticcheck
+	}
+	if err := os.Rename(tempDir, config.ExportPath); err != nil {
+		os.Rename(old, config.ExportPath) //nolint:errcheck
+
+		return fmt.Errorf("Error replacing export directory: %s", err) //nolint:staticcheck
+	}
+	return removeAll(old)
+}
+
+// exportDisk makes a disk image of the export_format from the export of the
+// container at export_path, and returns its SHA-256 checksum.
+func (s *StepExport) exportDisk(driver Driver, containerId string, config *Config) (string, error) {
+	rootfs, err := s.unpack(driver, containerId, config)
+	if err != nil {
+		return "", err
+	}
+	defer removeAll(rootfs) //nolint:errcheck
+
+	var size int64
+	if config.ExportDiskSize != "" {
+		// Validated by Prepare
+		size, _ = parseSize(config.ExportDiskSize)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(config.ExportPath), "."+filepath.Base(config.ExportPath)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("Error creating output file: %s", err) //nolint:staticcheck
+	}
+	f.Close()                 //nolint:errcheck
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	if err := makeDisk(f.Name(), config.ExportFormat, rootfs, size, config.ExportDiskLabel); err != nil {
+		return "", err
+	}
+	sum, err := fileSha256(f.Name())
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return "", err
+	}
+
+	return sum, os.Rename(f.Name(), config.ExportPath)
+}
+
+// unpack unpacks the export of the container to a new temp directory next to
+// export_path, and returns it.
+func (s *StepExport) unpack(driver Driver, containerId string, config *Config) (string, error) {
+	parent := filepath.Dir(config.ExportPath)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	tempDir, err := os.MkdirTemp(parent, "."+filepath.Base(config.ExportPath)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("Error creating export directory: %s", err) //nolint:staticcheck
+	}
+
+	err = streamExport(driver, containerId, newUnpacker(tempDir, exportFilter(config)).Unpack)
+	if err != nil {
+		removeAll(tempDir) //nolint:errcheck
+		return "", err
+	}
+
+	return tempDir, nil
+}
+
 func (s *StepExport) Cleanup(state multistep.StateBag) {}
+
+// writeFileAtomic writes a file through a temp file in the same directory,
+// renamed to path once write succeeded, so that a failed write never leaves a
+// partial file at path.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("Error creating output file: %s", err) //nolint:staticcheck
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	if err := write(f); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	// CreateTemp makes the file only readable by its owner
+	if err := f.Chmod(0644); err != nil {
+		f.Close() //nolint:errcheck
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// fileSha256 returns the SHA-256 checksum of a file.
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// removeAll removes a directory unpacked from an export, making its read-only
+// directories writable first, which is needed when not running as root.
+func removeAll(dir string) error {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error { //nolint:errcheck
+		if err == nil && d.IsDir() {
+			os.Chmod(path, 0700) //nolint:errcheck
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
@@ -2,9 +2,15 @@ package podman
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -25,16 +31,11 @@ func TestStepExport(t *testing.T) {
 	step := new(StepExport)
 	defer step.Cleanup(state)
 
-	// Create a tempfile for our output path
-	tf, err := os.CreateTemp("", "packer")
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
-	tf.Close()                 //nolint:errcheck
-	defer os.Remove(tf.Name()) //nolint:errcheck
+	// Export to a directory that doesn't exist yet
+	exportPath := filepath.Join(t.TempDir(), "out", "image.tar")
 
 	config := state.Get("config").(*Config)
-	config.ExportPath = tf.Name()
+	config.ExportPath = exportPath
 	driver := state.Get("driver").(*MockDriver)
 	driver.ExportReader = bytes.NewReader([]byte("data!"))
 
@@ -52,7 +53,7 @@ func TestStepExport(t *testing.T) {
 	}
 
 	// verify the data exported to the file
-	contents, err := os.ReadFile(tf.Name())
+	contents, err := os.ReadFile(exportPath)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -60,6 +61,63 @@ func TestStepExport(t *testing.T) {
 	if string(contents) != "data!" {
 		t.Fatalf("bad: %#v", string(contents))
 	}
+
+	// verify the checksum of the export is saved, and written next to it
+	sum := sha256.Sum256([]byte("data!"))
+	if state.Get("export_sha256") != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad sha256: %#v", state.Get("export_sha256"))
+	}
+	checksum, err := os.ReadFile(exportPath + ".sha256")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := hex.EncodeToString(sum[:]) + "  image.tar\n"; string(checksum) != expected {
+		t.Fatalf("bad checksum file: %q", checksum)
+	}
+
+	// verify no temp file is left behind
+	entries, err := os.ReadDir(filepath.Dir(exportPath))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("bad files: %#v", entries)
+	}
+}
+
+func TestStepExport_compression(t *testing.T) {
+	state := testStepExportState(t)
+	step := new(StepExport)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ExportPath = filepath.Join(t.TempDir(), "image.tar.gz")
+	config.ExportCompression = "gzip"
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportReader = bytes.NewReader([]byte("data!"))
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	contents, err := os.ReadFile(config.ExportPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "data!" {
+		t.Fatalf("bad data: %q %v", data, err)
+	}
+
+	// the checksum is the one of the compressed file
+	sum := sha256.Sum256(contents)
+	if state.Get("export_sha256") != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad sha256: %#v", state.Get("export_sha256"))
+	}
 }
 
 func TestStepExport_error(t *testing.T) {
@@ -93,8 +151,133 @@ func TestStepExport_error(t *testing.T) {
 		t.Fatal("should have error")
 	}
 
-	// verify we didn't make that file
+	// verify we didn't make that file, nor left a temp file behind
 	if _, err := os.Stat(tf.Name()); err == nil {
 		t.Fatal("export path shouldn't exist")
 	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(tf.Name()), "."+filepath.Base(tf.Name())+".*")); len(matches) > 0 {
+		t.Fatalf("temp files left behind: %#v", matches)
+	}
+}
+
+func TestStepExport_directory(t *testing.T) {
+	state := testStepExportState(t)
+	step := new(StepExport)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ExportPath = filepath.Join(t.TempDir(), "rootfs")
+	config.ExportFormat = "directory"
+	config.ExportExcludes = []string{"/var/cache/*"}
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportReader = testTar(t)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(config.ExportPath, "readonly"), 0755) }) //nolint:errcheck
+
+	data, err := os.ReadFile(filepath.Join(config.ExportPath, "etc", "hostname"))
+	if err != nil || string(data) != "web\n" {
+		t.Fatalf("bad file: %q %v", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(config.ExportPath, "var", "cache", "dnf")); err == nil {
+		t.Fatal("excluded directory shouldn't be exported")
+	}
+	if state.Get("export_path") != config.ExportPath {
+		t.Fatalf("bad export_path: %#v", state.Get("export_path"))
+	}
+
+	// an existing directory is only replaced with -force
+	driver.ExportReader = testTar(t)
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// a failed export keeps the existing directory, even with -force
+	state.Remove("error")
+	config.PackerForce = true
+	driver.ExportReader = bytes.NewReader([]byte("not a tar"))
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, err := os.Stat(filepath.Join(config.ExportPath, "etc", "hostname")); err != nil {
+		t.Fatalf("existing directory should be kept: %s", err)
+	}
+
+	state.Remove("error")
+	driver.ExportReader = testTar(t)
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(config.ExportPath, "readonly"), 0755) }) //nolint:errcheck
+	entries, err := os.ReadDir(filepath.Dir(config.ExportPath))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("the previous directory should be removed: %v %v", entries, err)
+	}
+}
+
+func TestStepExport_directoryError(t *testing.T) {
+	state := testStepExportState(t)
+	step := new(StepExport)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ExportPath = filepath.Join(t.TempDir(), "rootfs")
+	config.ExportFormat = "directory"
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportReader = bytes.NewReader([]byte("not a tar"))
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// nothing is left behind
+	entries, err := os.ReadDir(filepath.Dir(config.ExportPath))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("bad files: %#v", entries)
+	}
+}
+
+func TestStepExport_disk(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 isn't installed")
+	}
+
+	state := testStepExportState(t)
+	step := new(StepExport)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ExportPath = filepath.Join(t.TempDir(), "disk.raw")
+	config.ExportFormat = "raw"
+	config.ExportDiskSize = "32M"
+	config.ExportDiskLabel = "web"
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExportReader = testTar(t)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	testExt4(t, config.ExportPath, partitionOffset, "web")
+
+	// the checksum is written, and the unpacked files removed
+	contents, err := os.ReadFile(config.ExportPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum := sha256.Sum256(contents)
+	if state.Get("export_sha256") != hex.EncodeToString(sum[:]) {
+		t.Fatalf("bad sha256: %#v", state.Get("export_sha256"))
+	}
+	entries, err := os.ReadDir(filepath.Dir(config.ExportPath))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("bad files: %#v", entries)
+	}
 }
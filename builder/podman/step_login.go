@@ -0,0 +1,132 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepLogin sets up the auth file of the build, from the authfile option and
+// by logging in with the login options, or with the credentials of the
+// login_credential_helper. It lives in a private directory of
+// its own, as the temp dir is shared with the container, and is removed once
+// the build is done, so that the credentials never touch the auth file of the
+// user.
+type StepLogin struct {
+	dir      string
+	loggedIn bool
+}
+
+func (s *StepLogin) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining podman config") //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if !config.Login && config.AuthFile == "" {
+		return multistep.ActionContinue
+	}
+
+	driver := state.Get("driver").(Driver)
+
+	dir, err := ConfigTmpDir()
+	if err != nil {
+		return s.halt(state, ui, fmt.Errorf("Error making auth dir: %s", err)) //nolint:staticcheck
+	}
+	s.dir = dir
+	authfile := filepath.Join(dir, "auth.json")
+
+	if config.AuthFile != "" {
+		if err := copyAuthFile(authfile, config.AuthFile); err != nil {
+			return s.halt(state, ui, fmt.Errorf("Error copying authfile: %s", err)) //nolint:staticcheck
+		}
+	}
+
+	if config.Login {
+		username, password := config.LoginUsername, config.LoginPassword
+		if config.LoginCredentialHelper != "" {
+			ui.Message(fmt.Sprintf("Getting credentials from %s...", credentialHelperPath(config.LoginCredentialHelper)))
+			username, password, err = credentialHelperGet(config.LoginCredentialHelper, config.LoginServer)
+			if err != nil {
+				return s.halt(state, ui, err)
+			}
+			packersdk.LogSecretFilter.Set(password)
+		}
+
+		ui.Message("Logging in...")
+		err := driver.Login(&LoginConfig{
+			Server:        config.LoginServer,
+			Username:      username,
+			Password:      password,
+			AuthFile:      authfile,
+			SkipTLSVerify: config.LoginSkipTLSVerify,
+			CertDir:       config.LoginCertDir,
+		})
+		if err != nil {
+			return s.halt(state, ui, fmt.Errorf("Error logging in: %s", err)) //nolint:staticcheck
+		}
+		s.loggedIn = true
+	}
+
+	state.Put("authfile", authfile)
+	return multistep.ActionContinue
+}
+
+func (s *StepLogin) halt(state multistep.StateBag, ui packersdk.Ui, err error) multistep.StepAction {
+	state.Put("error", err)
+	ui.Error(err.Error())
+	return multistep.ActionHalt
+}
+
+func (s *StepLogin) Cleanup(state multistep.StateBag) {
+	if s.dir == "" {
+		return
+	}
+
+	if s.loggedIn {
+		driver := state.Get("driver").(Driver)
+		ui := state.Get("ui").(packersdk.Ui)
+		config := state.Get("config").(*Config)
+
+		ui.Message("Logging out...")
+		if err := driver.Logout(config.LoginServer, filepath.Join(s.dir, "auth.json")); err != nil {
+			ui.Error(fmt.Sprintf("Error logging out: %s", err))
+		}
+		s.loggedIn = false
+	}
+
+	if err := os.RemoveAll(s.dir); err != nil {
+		log.Printf("Error removing auth dir %s: %s", s.dir, err)
+	}
+	s.dir = ""
+}
+
+// copyAuthFile copies the auth file at src to dst, only readable by its
+// owner.
+func copyAuthFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close() //nolint:errcheck
+		return err
+	}
+	return out.Close()
+}
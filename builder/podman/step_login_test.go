@@ -0,0 +1,177 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func testStepLoginState(t *testing.T) multistep.StateBag {
+	t.Setenv("PACKER_TMP_DIR", t.TempDir())
+	return testState(t)
+}
+
+func TestStepLogin_impl(t *testing.T) {
+	var _ multistep.Step = new(StepLogin)
+}
+
+func TestStepLogin_disabled(t *testing.T) {
+	state := testStepLoginState(t)
+	step := new(StepLogin)
+	defer step.Cleanup(state)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("authfile"); ok {
+		t.Fatal("shouldn't have an auth file")
+	}
+}
+
+func TestStepLogin(t *testing.T) {
+	state := testStepLoginState(t)
+	step := new(StepLogin)
+
+	config := state.Get("config").(*Config)
+	config.Login = true
+	config.LoginServer = "registry.example.com"
+	config.LoginUsername = "user"
+	config.LoginPassword = "secret"
+	config.LoginSkipTLSVerify = true
+	config.LoginCertDir = "/etc/certs"
+	driver := state.Get("driver").(*MockDriver)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we logged in to the auth file of the build
+	authfile := state.Get("authfile").(string)
+	if !driver.LoginCalled {
+		t.Fatal("should have logged in")
+	}
+	expected := &LoginConfig{
+		Server:        "registry.example.com",
+		Username:      "user",
+		Password:      "secret",
+		AuthFile:      authfile,
+		SkipTLSVerify: true,
+		CertDir:       "/etc/certs",
+	}
+	if !reflect.DeepEqual(driver.LoginConfig, expected) {
+		t.Fatalf("bad login: %#v", driver.LoginConfig)
+	}
+
+	// verify we logged out and removed the auth file
+	step.Cleanup(state)
+	if !driver.LogoutCalled || driver.LogoutRepo != "registry.example.com" || driver.LogoutAuthFile != authfile {
+		t.Fatalf("bad logout: %#v", driver)
+	}
+	if _, err := os.Stat(filepath.Dir(authfile)); !os.IsNotExist(err) {
+		t.Fatalf("auth dir should be removed: %v", err)
+	}
+}
+
+func TestStepLogin_error(t *testing.T) {
+	state := testStepLoginState(t)
+	step := new(StepLogin)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Login = true
+	driver := state.Get("driver").(*MockDriver)
+	driver.LoginErr = errors.New("unauthorized")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+
+	// there is nothing to log out from
+	step.Cleanup(state)
+	if driver.LogoutCalled {
+		t.Fatal("shouldn't have logged out")
+	}
+}
+
+func TestStepLogin_authfile(t *testing.T) {
+	state := testStepLoginState(t)
+	step := new(StepLogin)
+	defer step.Cleanup(state)
+
+	src := filepath.Join(t.TempDir(), "auth.json")
+	data := `{"auths":{"registry.example.com":{"auth":"dXNlcjpzZWNyZXQ="}}}`
+	if err := os.WriteFile(src, []byte(data), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config := state.Get("config").(*Config)
+	config.AuthFile = src
+	driver := state.Get("driver").(*MockDriver)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if driver.LoginCalled {
+		t.Fatal("shouldn't have logged in")
+	}
+
+	// verify the auth file was copied, only readable by its owner
+	authfile := state.Get("authfile").(string)
+	if authfile == src {
+		t.Fatal("auth file should be copied")
+	}
+	fi, err := os.Stat(authfile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad mode: %s", fi.Mode())
+	}
+	copied, err := os.ReadFile(authfile)
+	if err != nil || string(copied) != data {
+		t.Fatalf("bad auth file: %q %v", copied, err)
+	}
+}
+
+func TestStepLogin_credentialHelper(t *testing.T) {
+	state := testStepLoginState(t)
+	step := new(StepLogin)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Login = true
+	config.LoginServer = "gcr.io"
+	config.LoginCredentialHelper = testCredentialHelper(t,
+		`echo '{"ServerURL":"gcr.io","Username":"oauth2accesstoken","Secret":"ya29.token"}'`)
+	driver := state.Get("driver").(*MockDriver)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if login := driver.LoginConfig; login == nil || login.Server != "gcr.io" || login.Username != "oauth2accesstoken" || login.Password != "ya29.token" {
+		t.Fatalf("bad login: %#v", login)
+	}
+
+	// A failing helper fails the build before logging in
+	state = testStepLoginState(t)
+	config = state.Get("config").(*Config)
+	config.Login = true
+	config.LoginServer = "gcr.io"
+	config.LoginCredentialHelper = testCredentialHelper(t, "exit 1")
+	driver = state.Get("driver").(*MockDriver)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if driver.LoginCalled {
+		t.Fatal("shouldn't have logged in")
+	}
+}
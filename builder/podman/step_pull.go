@@ -26,39 +26,43 @@ func (s *StepPull) Run(ctx context.Context, state multistep.StateBag) multistep.
 		return multistep.ActionContinue
 	}
 
-	ui.Say(fmt.Sprintf("Pulling Podman image: %s", config.Image))
-
 	driver := state.Get("driver").(Driver)
 
-	if config.Login {
-		ui.Message("Logging in...")
-		err := driver.Login(
-			config.LoginServer,
-			config.LoginUsername,
-			config.LoginPassword)
-		if err != nil {
-			err := fmt.Errorf("Error logging in: %s", err) //nolint:staticcheck
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return multistep.ActionHalt
-		}
-
-		defer func() {
-			ui.Message("Logging out...")
-			if err := driver.Logout(config.LoginServer); err != nil {
-				ui.Error(fmt.Sprintf("Error logging out: %s", err))
-			}
-
-		}()
+	// The digest of the local image, if there is one, tells whether the
+	// image needs to be pulled and whether the pull changed it.
+	localDigest, err := driver.Digest(config.Image)
+	local := err == nil
+	switch {
+	case config.PullPolicy == "never" && !local:
+		err := fmt.Errorf("Image %s not found locally, and pull_policy is never", config.Image) //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	case config.PullPolicy == "never", config.PullPolicy == "missing" && local:
+		ui.Say(fmt.Sprintf("Using the local Podman image: %s (pull_policy %s)", config.Image, config.PullPolicy))
+		return multistep.ActionContinue
 	}
 
-	if err := driver.Pull(config.Image); err != nil {
+	ui.Say(fmt.Sprintf("Pulling Podman image: %s (pull_policy %s)", config.Image, config.PullPolicy))
+
+	authfile, _ := state.Get("authfile").(string)
+	if err := driver.Pull(config.Image, config.PullPolicy, authfile); err != nil {
 		err := fmt.Errorf("Error pulling Podman image: %s", err) //nolint:staticcheck
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
+	digest, err := driver.Digest(config.Image)
+	switch {
+	case err != nil:
+		log.Printf("Error getting the digest of the pulled image: %s", err)
+	case local && digest == localDigest:
+		ui.Message(fmt.Sprintf("Local image is up to date: %s", digest))
+	default:
+		ui.Message(fmt.Sprintf("Pulled image: %s", digest))
+	}
+
 	return multistep.ActionContinue
 }
 
@@ -1,11 +1,14 @@
 package podman
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 func TestStepPull_impl(t *testing.T) {
@@ -53,32 +56,22 @@ func TestStepPull_error(t *testing.T) {
 	}
 }
 
-func TestStepPull_login(t *testing.T) {
+func TestStepPull_authfile(t *testing.T) {
 	state := testState(t)
 	step := new(StepPull)
 	defer step.Cleanup(state)
 
-	config := state.Get("config").(*Config)
+	state.Put("authfile", "/tmp/auth.json")
 	driver := state.Get("driver").(*MockDriver)
 
-	config.Login = true
-
 	// run the step
 	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
 		t.Fatalf("bad action: %#v", action)
 	}
 
-	// verify we pulled
-	if !driver.PullCalled {
-		t.Fatal("should've pulled")
-	}
-
-	// verify we logged in
-	if !driver.LoginCalled {
-		t.Fatal("should've logged in")
-	}
-	if !driver.LogoutCalled {
-		t.Fatal("should've logged out")
+	// verify we pulled with the auth file of the build
+	if driver.PullAuthFile != "/tmp/auth.json" {
+		t.Fatalf("bad authfile: %s", driver.PullAuthFile)
 	}
 }
 
@@ -102,3 +95,82 @@ func TestStepPull_noPull(t *testing.T) {
 		t.Fatal("shouldn't have pulled")
 	}
 }
+
+func TestStepPull_policy(t *testing.T) {
+	cases := []struct {
+		policy string
+		local  bool
+		pull   bool
+		halt   bool
+	}{
+		{policy: "always", local: true, pull: true},
+		{policy: "always", local: false, pull: true},
+		{policy: "newer", local: true, pull: true},
+		{policy: "missing", local: true, pull: false},
+		{policy: "missing", local: false, pull: true},
+		{policy: "never", local: true, pull: false},
+		{policy: "never", local: false, pull: false, halt: true},
+	}
+	for _, tc := range cases {
+		state := testState(t)
+		step := new(StepPull)
+
+		config := state.Get("config").(*Config)
+		config.PullPolicy = tc.policy
+		driver := state.Get("driver").(*MockDriver)
+		if !tc.local {
+			driver.DigestErr = errors.New("image not known")
+		}
+
+		expected := multistep.ActionContinue
+		if tc.halt {
+			expected = multistep.ActionHalt
+		}
+		if action := step.Run(context.Background(), state); action != expected {
+			t.Fatalf("%s, local %t: bad action: %#v", tc.policy, tc.local, action)
+		}
+		if driver.PullCalled != tc.pull {
+			t.Fatalf("%s, local %t: bad pull: %t", tc.policy, tc.local, driver.PullCalled)
+		}
+		if tc.pull && driver.PullPolicy != tc.policy {
+			t.Fatalf("%s, local %t: bad policy: %s", tc.policy, tc.local, driver.PullPolicy)
+		}
+		step.Cleanup(state)
+	}
+}
+
+func TestStepPull_upToDate(t *testing.T) {
+	state := testState(t)
+	step := new(StepPull)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.PullPolicy = "newer"
+	driver := state.Get("driver").(*MockDriver)
+	driver.DigestResults = map[string]string{config.Image: "sha256:aaa"}
+	driver.PullDigest = "sha256:aaa"
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	out := state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	if !strings.Contains(out, "Local image is up to date: sha256:aaa") {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	// A newer image was pulled
+	state = testState(t)
+	config = state.Get("config").(*Config)
+	config.PullPolicy = "newer"
+	driver = state.Get("driver").(*MockDriver)
+	driver.DigestResults = map[string]string{config.Image: "sha256:aaa"}
+	driver.PullDigest = "sha256:bbb"
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	out = state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	if !strings.Contains(out, "Pulled image: sha256:bbb") {
+		t.Fatalf("bad output: %s", out)
+	}
+}
@@ -1,8 +1,13 @@
 package podman
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
@@ -10,6 +15,13 @@ import (
 
 type StepRun struct {
 	containerId string
+
+	// stopLogs stops following the logs of the container, and logsDone is
+	// closed once all of them are written.
+	stopLogs context.CancelFunc
+	logsDone chan struct{}
+	// logsFile is the temp file the logs are spooled to.
+	logsFile string
 }
 
 func (s *StepRun) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -23,23 +35,25 @@ func (s *StepRun) Run(ctx context.Context, state multistep.StateBag) multistep.S
 	}
 
 	runConfig := ContainerConfig{
+		Name:       config.ContainerName,
+		Replace:    config.ReplaceContainer,
 		Image:      config.Image,
 		RunCommand: config.RunCommand,
 		Device:     config.Device,
 		TmpFs:      config.TmpFs,
-		Volumes:    make(map[string]string),
+		Mounts:     make([]MountConfig, 0, len(config.Mounts)+1),
 		CapAdd:     config.CapAdd,
 		CapDrop:    config.CapDrop,
 		Privileged: config.Privileged,
 		Systemd:    config.Systemd,
+		Labels:     containerLabels(config),
 	}
+	runConfig.AuthFile, _ = state.Get("authfile").(string)
 
-	for host, container := range config.Volumes {
-		runConfig.Volumes[host] = container
-	}
+	runConfig.Mounts = append(runConfig.Mounts, config.Mounts...)
 
 	tempDir := state.Get("temp_dir").(string)
-	runConfig.Volumes[tempDir] = config.ContainerDir
+	runConfig.Mounts = append(runConfig.Mounts, tempDirMount(tempDir, config))
 
 	driver := state.Get("driver").(Driver)
 	ui.Say("Starting podman container...")
@@ -58,9 +72,68 @@ func (s *StepRun) Run(ctx context.Context, state multistep.StateBag) multistep.S
 	// instance id inside of the provisioners, used in step_provision.
 	state.Put("instance_id", s.containerId)
 	ui.Message(fmt.Sprintf("Container ID: %s", s.containerId))
+
+	if err := s.followLogs(driver, ui); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
 	return multistep.ActionContinue
 }
 
+// followLogs spools the logs of the container to a temp file as they arrive,
+// until the container exits or the step is cleaned up, so that they can be
+// shown if the build fails even though the container is gone by then.
+func (s *StepRun) followLogs(driver Driver, ui packersdk.Ui) error {
+	f, err := os.CreateTemp("", "packer-podman-logs-*.log")
+	if err != nil {
+		return fmt.Errorf("Error creating container logs file: %s", err) //nolint:staticcheck
+	}
+	s.logsFile = f.Name()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopLogs = cancel
+	done := make(chan struct{})
+	s.logsDone = done
+	go func(containerId string) {
+		defer close(done)
+		if err := driver.Logs(ctx, containerId, f); err != nil {
+			ui.Error(fmt.Sprintf("Error reading container logs: %s", err))
+		}
+		if err := f.Close(); err != nil {
+			ui.Error(fmt.Sprintf("Error writing container logs: %s", err))
+		}
+	}(s.containerId)
+
+	return nil
+}
+
+// tempDirMount returns the mount sharing the temp dir with the container. On
+// SELinux enforcing hosts the directory is relabeled, otherwise the container
+// is denied access to it, unless the user picked a relabel option themselves.
+func tempDirMount(tempDir string, config *Config) MountConfig {
+	mount := MountConfig{
+		Type:        "bind",
+		Source:      tempDir,
+		Destination: config.ContainerDir,
+		Options:     config.ContainerDirMountOptions,
+	}
+
+	for _, opt := range mount.Options {
+		if strings.HasPrefix(opt, "relabel=") {
+			return mount
+		}
+	}
+
+	if selinuxEnforcing() {
+		log.Printf("SELinux is enforcing, relabeling %s", tempDir)
+		mount.Relabel = "private"
+	}
+
+	return mount
+}
+
 func (s *StepRun) Cleanup(state multistep.StateBag) {
 	if s.containerId == "" {
 		return
@@ -69,14 +142,110 @@ func (s *StepRun) Cleanup(state multistep.StateBag) {
 	driver := state.Get("driver").(Driver)
 	ui := state.Get("ui").(packersdk.Ui)
 
-	// Kill the container. We don't handle errors because errors usually
-	// just mean that the container doesn't exist anymore, which isn't a
-	// big deal.
-	ui.Say(fmt.Sprintf("Killing the container: %s", s.containerId))
+	if s.stopLogs != nil {
+		s.stopLogs()
+		<-s.logsDone
+		s.stopLogs = nil
+	}
+	if s.logsFile != "" {
+		defer os.Remove(s.logsFile) //nolint:errcheck
+	}
+
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if cancelled || halted {
+		config := state.Get("config").(*Config)
+		s.reportState(driver, ui)
+		if s.logsFile != "" {
+			s.reportLogs(ui, config.ContainerLogsPath)
+		}
 
-	//nolint:errcheck
-	driver.KillContainer(s.containerId)
+		if config.KeepContainer {
+			// Let StepTempDir know that the container still uses the temp dir
+			state.Put("container_kept", true)
+			ui.Say(keptContainerMessage(s.containerId, state.Get("temp_dir").(string)))
+			s.containerId = ""
+			s.logsFile = ""
+			return
+		}
+	}
+
+	// Kill and remove the container. A container that doesn't exist anymore
+	// isn't an error, so anything reported here means it is left behind.
+	ui.Say(fmt.Sprintf("Killing the container: %s", s.containerId))
+	if err := driver.KillContainer(s.containerId); err != nil {
+		ui.Error(fmt.Sprintf("Error removing the container %s: %s", s.containerId, err))
+	}
 
 	// Reset the container ID so that we're idempotent
 	s.containerId = ""
+	s.logsFile = ""
+}
+
+// reportState reports the state of the failed container, so that it isn't
+// lost when it is removed.
+func (s *StepRun) reportState(driver Driver, ui packersdk.Ui) {
+	if cs, err := driver.ContainerState(s.containerId); err != nil {
+		ui.Error(fmt.Sprintf("Error inspecting the container: %s", err))
+	} else {
+		msg := fmt.Sprintf("Container state: %s, exit code: %d, OOM killed: %t",
+			cs.Status, cs.ExitCode, cs.OOMKilled)
+		if cs.Error != "" {
+			msg = fmt.Sprintf("%s, error: %s", msg, cs.Error)
+		}
+		ui.Say(msg)
+	}
+}
+
+// reportLogs writes the spooled logs of the failed container to logsPath if
+// set, or else prints them.
+func (s *StepRun) reportLogs(ui packersdk.Ui, logsPath string) {
+	f, err := os.Open(s.logsFile)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error reading container logs: %s", err))
+		return
+	}
+	defer f.Close() //nolint:errcheck
+
+	if logsPath != "" {
+		dst, err := os.Create(logsPath)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error creating container logs file: %s", err))
+			return
+		}
+		_, err = io.Copy(dst, f)
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("Error writing container logs: %s", err))
+			return
+		}
+		ui.Say(fmt.Sprintf("Container logs written to %s", logsPath))
+		return
+	}
+
+	ui.Say("Container logs:")
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			ui.Message(strings.TrimSuffix(line, "\n"))
+		}
+		if err != nil {
+			if err != io.EOF {
+				ui.Error(fmt.Sprintf("Error reading container logs: %s", err))
+			}
+			return
+		}
+	}
+}
+
+// keptContainerMessage explains how to inspect and remove a container that
+// is left in place after a failed build.
+func keptContainerMessage(containerId string, tempDir string) string {
+	return fmt.Sprintf("Keeping the container %[1]s for debugging. Inspect it with:\n"+
+		"    podman exec -it %[1]s /bin/sh\n"+
+		"When done, remove it and its temp dir with:\n"+
+		"    podman rm -f %[1]s && rm -rf %[2]s", containerId, tempDir)
 }
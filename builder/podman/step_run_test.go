@@ -1,11 +1,17 @@
 package podman
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
 func testStepRunState(t *testing.T) multistep.StateBag {
@@ -18,12 +24,30 @@ func TestStepRun_impl(t *testing.T) {
 	var _ multistep.Step = new(StepRun)
 }
 
+func testSELinux(t *testing.T, mode string) {
+	old := selinuxEnforcePath
+	t.Cleanup(func() { selinuxEnforcePath = old })
+
+	selinuxEnforcePath = filepath.Join(t.TempDir(), "enforce")
+	if mode == "" {
+		return
+	}
+	if err := os.WriteFile(selinuxEnforcePath, []byte(mode+"\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestStepRun(t *testing.T) {
+	testSELinux(t, "")
 	state := testStepRunState(t)
 	step := new(StepRun)
 	defer step.Cleanup(state)
 
 	config := state.Get("config").(*Config)
+	config.Mounts = []MountConfig{
+		{Type: "bind", Source: "/host", Destination: "/b"},
+		{Type: "bind", Source: "/host", Destination: "/a"},
+	}
 	driver := state.Get("driver").(*MockDriver)
 	driver.StartID = "foo"
 
@@ -40,6 +64,28 @@ func TestStepRun(t *testing.T) {
 		t.Fatalf("bad: %#v", driver.StartConfig.Image)
 	}
 
+	// verify the mounts keep their order and the temp dir is mounted last
+	expected := []MountConfig{
+		{Type: "bind", Source: "/host", Destination: "/b"},
+		{Type: "bind", Source: "/host", Destination: "/a"},
+		{Type: "bind", Source: "/foo", Destination: config.ContainerDir},
+	}
+	if !reflect.DeepEqual(driver.StartConfig.Mounts, expected) {
+		t.Fatalf("bad: %#v", driver.StartConfig.Mounts)
+	}
+
+	if driver.StartConfig.Name != config.ContainerName || driver.StartConfig.Replace {
+		t.Fatalf("bad name: %s %t", driver.StartConfig.Name, driver.StartConfig.Replace)
+	}
+	if driver.StartConfig.AuthFile != "" {
+		t.Fatalf("bad authfile: %s", driver.StartConfig.AuthFile)
+	}
+
+	// verify the container is labeled to find it if it is left behind
+	if driver.StartConfig.Labels[ownerLabel] != owner() {
+		t.Fatalf("bad labels: %#v", driver.StartConfig.Labels)
+	}
+
 	// verify the ID is saved
 	idRaw, ok := state.GetOk("container_id")
 	if !ok {
@@ -95,3 +141,218 @@ func TestStepRun_error(t *testing.T) {
 		t.Fatal("should not have stopped")
 	}
 }
+
+func TestTempDirMount(t *testing.T) {
+	config := testConfigStruct(t)
+
+	cases := []struct {
+		selinux  string
+		options  []string
+		expected string
+	}{
+		// No SELinux on the host
+		{"", nil, "type=bind,source=/foo,destination=/packer-files"},
+		// SELinux permissive
+		{"0", nil, "type=bind,source=/foo,destination=/packer-files"},
+		// SELinux enforcing
+		{"1", nil, "type=bind,source=/foo,destination=/packer-files,relabel=private"},
+		// SELinux enforcing with extra options
+		{"1", []string{"U"}, "type=bind,source=/foo,destination=/packer-files,relabel=private,U"},
+		// SELinux enforcing with a user provided relabel option
+		{"1", []string{"relabel=shared"}, "type=bind,source=/foo,destination=/packer-files,relabel=shared"},
+	}
+
+	for _, tc := range cases {
+		testSELinux(t, tc.selinux)
+		config.ContainerDirMountOptions = tc.options
+
+		if actual := tempDirMount("/foo", config).String(); actual != tc.expected {
+			t.Fatalf("bad: selinux %q, options %v: expected %q, got %q",
+				tc.selinux, tc.options, tc.expected, actual)
+		}
+	}
+}
+
+func TestStepRun_cleanupLogs(t *testing.T) {
+	state := testStepRunState(t)
+	step := new(StepRun)
+	defer step.Cleanup(state)
+
+	driver := state.Get("driver").(*MockDriver)
+	driver.StartID = "foo"
+	driver.LogsOutput = "provisioning failed\n"
+	driver.ContainerStateResult = &ContainerState{Status: "exited", ExitCode: 137, OOMKilled: true}
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// a successful build follows the logs, but neither prints them nor
+	// reports the state
+	logsFile := step.logsFile
+	step.Cleanup(state)
+	if !driver.LogsCalled || driver.LogsID != "foo" {
+		t.Fatalf("should've followed the logs: %#v", driver.LogsID)
+	}
+	if driver.ContainerStateCalled {
+		t.Fatal("shouldn't have inspected the container")
+	}
+	output := state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	if strings.Contains(output, "provisioning failed") {
+		t.Fatalf("output shouldn't contain the logs: %s", output)
+	}
+	if _, err := os.Stat(logsFile); !os.IsNotExist(err) {
+		t.Fatalf("should've removed the spooled logs: %v", err)
+	}
+
+	// run the step again, and fail the build
+	driver.KillCalled = false
+	driver.LogsCalled = false
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	state.Put(multistep.StateHalted, true)
+	logsFile = step.logsFile
+	step.Cleanup(state)
+
+	if _, err := os.Stat(logsFile); !os.IsNotExist(err) {
+		t.Fatalf("should've removed the spooled logs: %v", err)
+	}
+	if !driver.LogsCalled || driver.LogsID != "foo" {
+		t.Fatalf("should've followed the logs: %#v", driver.LogsID)
+	}
+	if !driver.KillCalled {
+		t.Fatal("should've killed the container")
+	}
+	output = state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	for _, expected := range []string{"provisioning failed", "exit code: 137", "OOM killed: true"} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("output should contain %q: %s", expected, output)
+		}
+	}
+}
+
+func TestStepRun_cleanupLogsPath(t *testing.T) {
+	state := testStepRunState(t)
+	step := new(StepRun)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ContainerLogsPath = filepath.Join(t.TempDir(), "container.log")
+	driver := state.Get("driver").(*MockDriver)
+	driver.StartID = "foo"
+	driver.LogsOutput = "provisioning failed\n"
+
+	// a successful build doesn't write them
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	step.Cleanup(state)
+	if _, err := os.Stat(config.ContainerLogsPath); !os.IsNotExist(err) {
+		t.Fatalf("shouldn't have written the logs: %v", err)
+	}
+
+	// run the step again and fail the build
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	state.Put(multistep.StateCancelled, true)
+	step.Cleanup(state)
+
+	// verify the logs went to the file
+	contents, err := os.ReadFile(config.ContainerLogsPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(contents) != driver.LogsOutput {
+		t.Fatalf("bad: %#v", string(contents))
+	}
+}
+
+func TestStepRun_cleanupLogsLines(t *testing.T) {
+	state := testStepRunState(t)
+	step := new(StepRun)
+	defer step.Cleanup(state)
+
+	driver := state.Get("driver").(*MockDriver)
+	driver.StartID = "foo"
+	driver.LogsOutput = "first line\nsecond line\nno newline"
+
+	// run the step and fail the build
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	state.Put(multistep.StateHalted, true)
+	step.Cleanup(state)
+
+	// verify each line was printed as a message
+	output := state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	for _, expected := range []string{"\nfirst line\n", "\nsecond line\n", "\nno newline\n"} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("output should contain %q: %s", expected, output)
+		}
+	}
+}
+
+func TestStepRun_cleanupKeepContainer(t *testing.T) {
+	state := testStepRunState(t)
+	step := new(StepRun)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.KeepContainer = true
+	driver := state.Get("driver").(*MockDriver)
+	driver.StartID = "foo"
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// a successful build still removes the container
+	step.Cleanup(state)
+	if !driver.KillCalled {
+		t.Fatal("should've killed the container")
+	}
+
+	// run the step again, and fail the build
+	driver.KillCalled = false
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	state.Put(multistep.StateHalted, true)
+	step.Cleanup(state)
+
+	if driver.KillCalled {
+		t.Fatal("shouldn't have killed the container")
+	}
+	if _, ok := state.GetOk("container_kept"); !ok {
+		t.Fatal("should've marked the container as kept")
+	}
+	output := state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	if !strings.Contains(output, "podman exec -it foo /bin/sh") {
+		t.Fatalf("output should contain the exec command: %s", output)
+	}
+}
+
+func TestStepRun_cleanupError(t *testing.T) {
+	state := testStepRunState(t)
+	step := new(StepRun)
+	defer step.Cleanup(state)
+
+	driver := state.Get("driver").(*MockDriver)
+	driver.StartID = "foo"
+	driver.KillError = errors.New("device or resource busy")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	step.Cleanup(state)
+
+	ui := state.Get("ui").(*packersdk.BasicUi)
+	output := ui.Writer.(*bytes.Buffer).String()
+	if !strings.Contains(output, "device or resource busy") {
+		t.Fatalf("should've reported the error: %s", output)
+	}
+}
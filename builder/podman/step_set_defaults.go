@@ -2,38 +2,326 @@ package podman
 
 import (
 	"context"
-	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
 	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
+// StepSetDefaults adds changes restoring the configuration of the base image
+// that the build container overrode, so that it doesn't end up in the
+// committed image. The entrypoint, command and user of the base image are
+// always restored, since the run command usually replaces the entrypoint with
+// a shell. Changes given by the user always take precedence.
+//
+// Changes can only set values, so the ports and the variables and labels
+// that the run command adds to the ones of the base image are kept, with a
+// warning.
 type StepSetDefaults struct{}
 
 func (s *StepSetDefaults) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
-	driver := state.Get("driver").(*PodmanDriver)
-	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining podman config") //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
 
-	// Fetch default CMD and ENTRYPOINT
-	defaultCmd, _ := driver.Cmd(config.Image)
-	defaultEntrypoint, _ := driver.Entrypoint(config.Image)
+	driver := state.Get("driver").(Driver)
 
-	// Set defaults if not provided by the user
-	hasCmd, hasEntrypoint := false, false
-	for _, change := range config.Changes {
-		if strings.HasPrefix(change, "CMD") {
-			hasCmd = true
-		} else if strings.HasPrefix(change, "ENTRYPOINT") {
-			hasEntrypoint = true
-		}
+	changes, warnings, err := defaultChanges(driver, config)
+	if err != nil {
+		err := fmt.Errorf("Error reading the configuration of %s: %s", config.Image, err) //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
 	}
 
-	if !hasCmd && defaultCmd != "" {
-		config.Changes = append(config.Changes, "CMD "+defaultCmd)
+	for _, change := range changes {
+		ui.Message(fmt.Sprintf("Restoring from base image: %s", change))
 	}
-	if !hasEntrypoint && defaultEntrypoint != "" {
-		config.Changes = append(config.Changes, "ENTRYPOINT "+defaultEntrypoint)
+	for _, warning := range warnings {
+		ui.Error(fmt.Sprintf("Warning: %s", warning))
 	}
+	config.Changes = append(config.Changes, changes...)
 
 	return multistep.ActionContinue
 }
 
 func (s *StepSetDefaults) Cleanup(state multistep.StateBag) {}
+
+// defaultChanges returns the changes restoring the entrypoint, command and
+// user of the base image, and the rest of its configuration that is
+// overridden by the run command, unless they are set by the user. It also
+// returns warnings about what the run command adds that can't be undone.
+func defaultChanges(driver Driver, config *Config) ([]string, []string, error) {
+	user := changesOverrides(config.Changes)
+	run := runCommandOverrides(config.RunCommand)
+	var warnings []string
+	if config.Squash == "all" {
+		// Importing the flattened filesystem starts from an empty
+		// configuration, so nothing of the base image is kept.
+		run = overrides{
+			instructions: map[string]bool{"WORKDIR": true, "USER": true, "EXPOSE": true},
+			allEnv:       true,
+			allLabels:    true,
+		}
+	} else {
+		if run.ports {
+			warnings = append(warnings,
+				"the ports exposed or published by run_command are kept in the committed image")
+		}
+		if run.allEnv {
+			warnings = append(warnings, "the environment variables that --env-file or --env-host "+
+				"of run_command add to the ones of the base image are kept in the committed image")
+		}
+		if run.allLabels {
+			warnings = append(warnings, "the labels that --label-file of run_command adds to "+
+				"the ones of the base image are kept in the committed image")
+		}
+	}
+
+	var changes []string
+
+	if !user.instructions["CMD"] {
+		cmd, err := driver.Cmd(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, "CMD "+jsonArray(cmd))
+	}
+
+	if !user.instructions["ENTRYPOINT"] {
+		entrypoint, err := driver.Entrypoint(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, "ENTRYPOINT "+jsonArray(entrypoint))
+	}
+
+	if run.instructions["WORKDIR"] && !user.instructions["WORKDIR"] {
+		workdir, err := driver.WorkingDir(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		if workdir == "" {
+			workdir = "/"
+		}
+		changes = append(changes, "WORKDIR "+workdir)
+	}
+
+	if !user.instructions["USER"] {
+		u, err := driver.User(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		if u == "" && run.instructions["USER"] {
+			u = "0"
+		}
+		if u != "" {
+			changes = append(changes, "USER "+u)
+		}
+	}
+
+	if run.allEnv || len(run.env) > 0 {
+		env, err := driver.Env(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		base := map[string]bool{}
+		for _, e := range env {
+			key, value, _ := strings.Cut(e, "=")
+			base[key] = true
+			if run.envSet(key) && !user.envSet(key) {
+				changes = append(changes, fmt.Sprintf("ENV %s=%s", key, quoteValue(value)))
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(run.env)) {
+			if !base[key] && !user.envSet(key) {
+				warnings = append(warnings, fmt.Sprintf(
+					"the environment variable %s set by run_command isn't in the base image and is kept in the committed image", key))
+			}
+		}
+	}
+
+	if run.allLabels || len(run.labels) > 0 {
+		labels, err := driver.Labels(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range slices.Sorted(maps.Keys(labels)) {
+			if run.labelSet(key) && !user.labelSet(key) {
+				changes = append(changes, fmt.Sprintf("LABEL %s=%s", key, quoteValue(labels[key])))
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(run.labels)) {
+			if _, ok := labels[key]; !ok && !user.labelSet(key) {
+				warnings = append(warnings, fmt.Sprintf(
+					"the label %s set by run_command isn't in the base image and is kept in the committed image", key))
+			}
+		}
+	}
+
+	if run.instructions["EXPOSE"] && !user.instructions["EXPOSE"] {
+		ports, err := driver.ExposedPorts(config.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ports) > 0 {
+			changes = append(changes, "EXPOSE "+strings.Join(ports, " "))
+		}
+	}
+
+	return changes, warnings, nil
+}
+
+// overrides records which parts of the image configuration are set, either
+// by the changes or by the run command.
+type overrides struct {
+	// instructions holds the instructions that are set, like CMD.
+	instructions map[string]bool
+	// env and labels hold the names of the variables and labels that are
+	// set, unless allEnv or allLabels is true.
+	env       map[string]bool
+	labels    map[string]bool
+	allEnv    bool
+	allLabels bool
+	// ports is true when the run command exposes or publishes ports.
+	ports bool
+}
+
+func newOverrides() overrides {
+	return overrides{
+		instructions: map[string]bool{},
+		env:          map[string]bool{},
+		labels:       map[string]bool{},
+	}
+}
+
+func (o overrides) envSet(key string) bool {
+	return o.allEnv || o.env[key]
+}
+
+func (o overrides) labelSet(key string) bool {
+	return o.allLabels || o.labels[key]
+}
+
+// changesOverrides returns what the given changes set.
+func changesOverrides(changes []string) overrides {
+	o := newOverrides()
+	for _, s := range changes {
+		c := parseChange(s)
+		o.instructions[c.Instruction] = true
+
+		switch c.Instruction {
+		case "ENV", "LABEL":
+			words, err := splitWords(c.Args)
+			if err != nil || len(words) == 0 {
+				continue
+			}
+			keys := o.env
+			if c.Instruction == "LABEL" {
+				keys = o.labels
+			}
+			if c.Instruction == "ENV" && !strings.Contains(words[0], "=") {
+				// Legacy `ENV KEY VALUE` form
+				keys[words[0]] = true
+				continue
+			}
+			for _, w := range words {
+				key, _, _ := strings.Cut(w, "=")
+				keys[key] = true
+			}
+		}
+	}
+
+	return o
+}
+
+// runCommandOverrides returns what the options of the run command set on the
+// container. Only the options before the image are looked at.
+func runCommandOverrides(args []string) overrides {
+	o := newOverrides()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "{{.Image}}" {
+			break
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if !strings.HasPrefix(flag, "--") {
+			// Short flags only take their value as the next argument
+			flag, value, hasValue = arg, "", false
+		}
+		next := func() string {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+
+		switch flag {
+		case "-e", "--env":
+			key, _, _ := strings.Cut(next(), "=")
+			o.env[key] = true
+		case "--env-file", "--env-host":
+			o.allEnv = true
+		case "-l", "--label":
+			key, _, _ := strings.Cut(next(), "=")
+			o.labels[key] = true
+		case "--label-file":
+			o.allLabels = true
+		case "-w", "--workdir":
+			next()
+			o.instructions["WORKDIR"] = true
+		case "-u", "--user":
+			next()
+			o.instructions["USER"] = true
+		case "--expose", "-p", "--publish":
+			next()
+			o.ports = true
+		case "-P", "--publish-all":
+			o.ports = true
+		}
+	}
+
+	return o
+}
+
+// jsonArray renders the arguments in the exec form of CMD and ENTRYPOINT.
+func jsonArray(args []string) string {
+	if args == nil {
+		args = []string{}
+	}
+	b, _ := json.Marshal(args)
+	return string(b)
+}
+
+// quoteValue quotes the values of ENV and LABEL changes that are empty or
+// contain whitespace, quotes, backslashes or dollars, escaping the `"`, `\`
+// and `$` in them, so that they're neither split nor expanded.
+func quoteValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\"'\\$") {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range v {
+		if strings.ContainsRune(`"\$`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
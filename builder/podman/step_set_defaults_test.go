@@ -0,0 +1,288 @@
+package podman
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func testStepSetDefaultsState(t *testing.T) multistep.StateBag {
+	state := testState(t)
+	config := state.Get("config").(*Config)
+	config.ExportPath = ""
+	config.Commit = true
+	return state
+}
+
+func TestStepSetDefaults_impl(t *testing.T) {
+	var _ multistep.Step = new(StepSetDefaults)
+}
+
+func TestStepSetDefaults(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Changes = []string{"USER nobody"}
+	driver := state.Get("driver").(*MockDriver)
+	driver.CmdResult = []string{"nginx", "-g", "daemon off;"}
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify the CMD and ENTRYPOINT of the image are carried over
+	if driver.CmdId != config.Image || driver.EntrypointId != config.Image {
+		t.Fatalf("bad image: %#v %#v", driver.CmdId, driver.EntrypointId)
+	}
+	expected := []string{
+		"USER nobody",
+		`CMD ["nginx","-g","daemon off;"]`,
+		"ENTRYPOINT []",
+	}
+	if !reflect.DeepEqual(config.Changes, expected) {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+
+	// verify the rest isn't looked at when the run command doesn't set it
+	if driver.EnvCalled || driver.LabelsCalled ||
+		driver.WorkingDirCalled || driver.ExposedPortsCalled {
+		t.Fatal("shouldn't have inspected the rest of the image")
+	}
+}
+
+func TestStepSetDefaults_userChanges(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Changes = []string{"cmd /bin/bash", `Entrypoint ["/init"]`, "user app"}
+	driver := state.Get("driver").(*MockDriver)
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify the changes of the user are kept as is
+	if driver.CmdCalled || driver.EntrypointCalled || driver.UserCalled {
+		t.Fatal("shouldn't have inspected the image")
+	}
+	if len(config.Changes) != 3 {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+}
+
+func TestStepSetDefaults_runCommand(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.RunCommand = []string{
+		"-d", "-i", "-t",
+		"-e", "PATH=/opt/bin", "--env=HOME=/tmp", "--env", "LANG=C",
+		"-l", "version=dev", "--label=maintainer=me",
+		"-w", "/build",
+		"--user=1000",
+		"--", "{{.Image}}", "-e", "IGNORED=1",
+	}
+	config.Changes = []string{"ENV LANG=C.UTF-8", "LABEL maintainer=you"}
+	driver := state.Get("driver").(*MockDriver)
+	driver.EnvResult = []string{"PATH=/usr/bin:/bin", "HOME=/root", "LANG=en_US", "IGNORED=0"}
+	driver.LabelsResult = map[string]string{"version": "1.0 beta", "maintainer": "them", "vendor": "acme"}
+	driver.WorkingDirResult = "/app"
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	expected := []string{
+		"ENV LANG=C.UTF-8",
+		"LABEL maintainer=you",
+		"CMD []",
+		"ENTRYPOINT []",
+		"WORKDIR /app",
+		"USER 0",
+		"ENV PATH=/usr/bin:/bin",
+		"ENV HOME=/root",
+		`LABEL version="1.0 beta"`,
+	}
+	if !reflect.DeepEqual(config.Changes, expected) {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+	if driver.ExposedPortsCalled {
+		t.Fatal("shouldn't have inspected the exposed ports")
+	}
+}
+
+func TestStepSetDefaults_runCommandKept(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.RunCommand = []string{
+		"-d", "-i", "-t",
+		"-e", "PATH=/opt/bin", "-e", "TOKEN=secret", "--env=SET=1",
+		"--label", "version=dev", "--label=new=x",
+		"--expose", "8080", "-p", "80:80",
+		"{{.Image}}",
+	}
+	config.Changes = []string{"ENV SET=2"}
+	driver := state.Get("driver").(*MockDriver)
+	driver.EnvResult = []string{"PATH=/usr/bin:/bin"}
+	driver.LabelsResult = map[string]string{"version": "1.0"}
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify what the base image has is restored
+	expected := []string{
+		"ENV SET=2",
+		"CMD []",
+		"ENTRYPOINT []",
+		"ENV PATH=/usr/bin:/bin",
+		"LABEL version=1.0",
+	}
+	if !reflect.DeepEqual(config.Changes, expected) {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+
+	// verify we warn about what can't be restored
+	out := state.Get("ui").(*packersdk.BasicUi).Writer.(*bytes.Buffer).String()
+	for _, warning := range []string{
+		"ports exposed or published by run_command are kept",
+		"environment variable TOKEN set by run_command",
+		"label new set by run_command",
+	} {
+		if !strings.Contains(out, warning) {
+			t.Fatalf("output should contain %q: %s", warning, out)
+		}
+	}
+	if strings.Contains(out, "variable SET") || strings.Contains(out, "variable PATH") {
+		t.Fatalf("shouldn't warn about restored variables: %s", out)
+	}
+}
+
+func TestStepSetDefaults_squashAll(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.Squash = "all"
+	driver := state.Get("driver").(*MockDriver)
+	driver.CmdResult = []string{"/bin/sh"}
+	driver.EnvResult = []string{"PATH=/usr/bin:/bin"}
+	driver.LabelsResult = map[string]string{"version": "1.0"}
+	driver.UserResult = "app"
+	driver.ExposedPortsResult = []string{"443/tcp", "80/tcp"}
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify the whole configuration is carried over
+	expected := []string{
+		`CMD ["/bin/sh"]`,
+		"ENTRYPOINT []",
+		"WORKDIR /",
+		"USER app",
+		"ENV PATH=/usr/bin:/bin",
+		"LABEL version=1.0",
+		"EXPOSE 443/tcp 80/tcp",
+	}
+	if !reflect.DeepEqual(config.Changes, expected) {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+}
+
+func TestStepSetDefaults_error(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(*MockDriver)
+	driver.EntrypointErr = errors.New("foo")
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we have an error and didn't touch the changes
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+	if len(config.Changes) != 0 {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+}
+
+func TestStepSetDefaults_user(t *testing.T) {
+	state := testStepSetDefaultsState(t)
+	step := new(StepSetDefaults)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(*MockDriver)
+	driver.EntrypointResult = []string{"/docker-entrypoint.sh"}
+	driver.UserResult = "nginx"
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify the default run command doesn't leak into the image
+	expected := []string{
+		"CMD []",
+		`ENTRYPOINT ["/docker-entrypoint.sh"]`,
+		"USER nginx",
+	}
+	if !reflect.DeepEqual(config.Changes, expected) {
+		t.Fatalf("bad: %#v", config.Changes)
+	}
+}
+
+func TestQuoteValue(t *testing.T) {
+	cases := map[string]string{
+		"":          `""`,
+		"C.UTF-8":   "C.UTF-8",
+		"1.0 beta":  `"1.0 beta"`,
+		`a"b`:       `"a\"b"`,
+		"$HOME/bin": `"\$HOME/bin"`,
+		`c:\x`:      `"c:\\x"`,
+		"it's":      `"it's"`,
+	}
+
+	for v, expected := range cases {
+		quoted := quoteValue(v)
+		if quoted != expected {
+			t.Fatalf("%s: bad: %s", v, quoted)
+		}
+
+		words, err := splitWords("KEY=" + quoted)
+		if err != nil {
+			t.Fatalf("%s: err: %s", v, err)
+		}
+		if !reflect.DeepEqual(words, []string{"KEY=" + v}) {
+			t.Fatalf("%s: bad: %#v", v, words)
+		}
+	}
+}
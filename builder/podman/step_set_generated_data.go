@@ -2,29 +2,78 @@ package podman
 
 import (
 	"context"
+	"log"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packerbuilderdata"
 )
 
+// StepSetGeneratedData publishes the generated data available so far. It runs
+// once the container is started, so that the provisioners can use the data
+// about the container, and again at the end of the build for the data about
+// the artifact. The variables that don't apply to the build are left empty.
 type StepSetGeneratedData struct {
 	GeneratedData *packerbuilderdata.GeneratedData
 }
 
 func (s *StepSetGeneratedData) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
 	driver := state.Get("driver").(Driver)
+	config := state.Get("config").(*Config)
+
+	containerId, _ := state.GetOk("container_id")
+	s.GeneratedData.Put("ContainerID", stringOrEmpty(containerId))
+	s.GeneratedData.Put("ContainerName", config.ContainerName)
+
+	podmanVersion := ""
+	if v, err := driver.Version(); err == nil {
+		podmanVersion = v.String()
+	} else {
+		log.Printf("[WARN] Error reading the podman version: %s", err)
+	}
+	s.GeneratedData.Put("PodmanVersion", podmanVersion)
+
+	s.GeneratedData.Put("BaseImageDigest", s.digest(driver, config.Image))
 
 	sha256 := "ERR_IMAGE_SHA256_NOT_FOUND"
-	if imageId, ok := state.GetOk("image_id"); ok {
+	imageDigest := ""
+	imageId, ok := state.GetOk("image_id")
+	if ok {
 		s256, err := driver.Sha256(imageId.(string))
 		if err == nil {
 			sha256 = s256
 		}
+		imageDigest = s.digest(driver, imageId.(string))
 	}
+	s.GeneratedData.Put("ImageID", stringOrEmpty(imageId))
 	s.GeneratedData.Put("ImageSha256", sha256)
+	s.GeneratedData.Put("ImageDigest", imageDigest)
+
+	exportPath, _ := state.GetOk("export_path")
+	exportSha256, _ := state.GetOk("export_sha256")
+	s.GeneratedData.Put("ExportPath", stringOrEmpty(exportPath))
+	s.GeneratedData.Put("ExportSha256", stringOrEmpty(exportSha256))
+
 	return multistep.ActionContinue
 }
 
+// digest returns the digest of the image, or an empty string if it can't be
+// read, which shouldn't fail the build.
+func (s *StepSetGeneratedData) digest(driver Driver, image string) string {
+	digest, err := driver.Digest(image)
+	if err != nil {
+		log.Printf("[WARN] Error reading the digest of %s: %s", image, err)
+		return ""
+	}
+	return digest
+}
+
 func (s *StepSetGeneratedData) Cleanup(_ multistep.StateBag) {
 	// No cleanup...
 }
+
+// stringOrEmpty returns the string read from the state, or an empty string
+// if it isn't there.
+func stringOrEmpty(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -2,6 +2,8 @@ package podman
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -49,3 +51,103 @@ func TestStepSetGeneratedData_Run(t *testing.T) {
 		t.Fatalf("Expected ImageSha256 to be %s but was %s", notImplementedMsg, imgSha256)
 	}
 }
+
+func testGeneratedData(t *testing.T, state multistep.StateBag) map[string]interface{} {
+	step := &StepSetGeneratedData{GeneratedData: &packerbuilderdata.GeneratedData{State: state}}
+	if action := step.Run(context.TODO(), state); action != multistep.ActionContinue {
+		t.Fatalf("Should not halt")
+	}
+	return state.Get("generated_data").(map[string]interface{})
+}
+
+func testGeneratedDataState(t *testing.T) multistep.StateBag {
+	state := testState(t)
+	state.Put("container_id", "foo")
+	config := state.Get("config").(*Config)
+	config.ContainerName = "packer-web"
+	driver := state.Get("driver").(*MockDriver)
+	driver.VersionVersion = "5.2.1"
+	driver.DigestResults = map[string]string{
+		config.Image: "sha256:base",
+		"12345":      "sha256:image",
+	}
+	driver.Sha256Result = "12345"
+	return state
+}
+
+func TestStepSetGeneratedData_modes(t *testing.T) {
+	common := map[string]interface{}{
+		"ContainerID":     "foo",
+		"ContainerName":   "packer-web",
+		"PodmanVersion":   "5.2.1",
+		"BaseImageDigest": "sha256:base",
+	}
+
+	cases := map[string]struct {
+		state    map[string]interface{}
+		expected map[string]interface{}
+	}{
+		// Before the artifact is made, and with discard
+		"container": {
+			expected: map[string]interface{}{
+				"ImageID":      "",
+				"ImageSha256":  "ERR_IMAGE_SHA256_NOT_FOUND",
+				"ImageDigest":  "",
+				"ExportPath":   "",
+				"ExportSha256": "",
+			},
+		},
+		"commit": {
+			state: map[string]interface{}{"image_id": "12345"},
+			expected: map[string]interface{}{
+				"ImageID":      "12345",
+				"ImageSha256":  "12345",
+				"ImageDigest":  "sha256:image",
+				"ExportPath":   "",
+				"ExportSha256": "",
+			},
+		},
+		"export": {
+			state: map[string]interface{}{"export_path": "foo", "export_sha256": "abcdef"},
+			expected: map[string]interface{}{
+				"ImageID":      "",
+				"ImageSha256":  "ERR_IMAGE_SHA256_NOT_FOUND",
+				"ImageDigest":  "",
+				"ExportPath":   "foo",
+				"ExportSha256": "abcdef",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			state := testGeneratedDataState(t)
+			for k, v := range tc.state {
+				state.Put(k, v)
+			}
+
+			genData := testGeneratedData(t, state)
+			for k, v := range common {
+				tc.expected[k] = v
+			}
+			if !reflect.DeepEqual(genData, tc.expected) {
+				t.Fatalf("bad generated data: %#v", genData)
+			}
+		})
+	}
+}
+
+func TestStepSetGeneratedData_errors(t *testing.T) {
+	state := testGeneratedDataState(t)
+	state.Put("image_id", "12345")
+	driver := state.Get("driver").(*MockDriver)
+	driver.VersionVersion = "unknown"
+	driver.DigestErr = errors.New("foo")
+
+	genData := testGeneratedData(t, state)
+	for _, k := range []string{"PodmanVersion", "BaseImageDigest", "ImageDigest"} {
+		if genData[k] != "" {
+			t.Fatalf("%s should be empty: %#v", k, genData[k])
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepStop stops or pauses the container before it is committed or exported,
+// according to the stop_before_commit and pause_before_commit options.
+type StepStop struct {
+	paused bool
+}
+
+func (s *StepStop) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining podman config") //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	driver := state.Get("driver").(Driver)
+	containerId := state.Get("container_id").(string)
+
+	var err error
+	switch {
+	case config.StopBeforeCommit:
+		ui.Say("Stopping the container")
+		err = driver.StopContainer(containerId, config.StopSignal, config.StopTimeout)
+	case config.PauseBeforeCommit:
+		var caps *Capabilities
+		caps, err = driver.Capabilities()
+		if err == nil && !caps.CanPause() {
+			err = fmt.Errorf("Rootless podman can only pause containers with cgroups v2, use stop_before_commit instead") //nolint:staticcheck
+		}
+		if err != nil {
+			break
+		}
+
+		ui.Say("Pausing the container")
+		err = driver.PauseContainer(containerId)
+		s.paused = err == nil
+	}
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepStop) Cleanup(state multistep.StateBag) {
+	if !s.paused {
+		return
+	}
+
+	driver := state.Get("driver").(Driver)
+	ui := state.Get("ui").(packersdk.Ui)
+	containerId := state.Get("container_id").(string)
+
+	if err := driver.UnpauseContainer(containerId); err != nil {
+		ui.Error(fmt.Sprintf("Error resuming the container: %s", err))
+	}
+	s.paused = false
+}
@@ -0,0 +1,127 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func testStepStopState(t *testing.T) multistep.StateBag {
+	state := testState(t)
+	state.Put("container_id", "foo")
+	return state
+}
+
+func TestStepStop_impl(t *testing.T) {
+	var _ multistep.Step = new(StepStop)
+}
+
+func TestStepStop_disabled(t *testing.T) {
+	state := testStepStopState(t)
+	step := new(StepStop)
+	defer step.Cleanup(state)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	driver := state.Get("driver").(*MockDriver)
+	if driver.StopCalled || driver.PauseCalled {
+		t.Fatal("shouldn't have stopped or paused the container")
+	}
+}
+
+func TestStepStop_stop(t *testing.T) {
+	state := testStepStopState(t)
+	step := new(StepStop)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.StopBeforeCommit = true
+	config.StopSignal = "SIGRTMIN+3"
+	config.StopTimeout = 30 * time.Second
+	driver := state.Get("driver").(*MockDriver)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	if !driver.StopCalled || driver.StopID != "foo" {
+		t.Fatalf("should've stopped foo: %#v", driver.StopID)
+	}
+	if driver.StopSignal != "SIGRTMIN+3" || driver.StopTimeout != 30*time.Second {
+		t.Fatalf("bad stop: %s %s", driver.StopSignal, driver.StopTimeout)
+	}
+
+	step.Cleanup(state)
+	if driver.UnpauseCalled {
+		t.Fatal("shouldn't have resumed the container")
+	}
+}
+
+func TestStepStop_stopError(t *testing.T) {
+	state := testStepStopState(t)
+	step := new(StepStop)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.StopBeforeCommit = true
+	driver := state.Get("driver").(*MockDriver)
+	driver.StopError = errors.New("foo")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+}
+
+func TestStepStop_pause(t *testing.T) {
+	state := testStepStopState(t)
+	step := new(StepStop)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.PauseBeforeCommit = true
+	driver := state.Get("driver").(*MockDriver)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if !driver.PauseCalled || driver.PauseID != "foo" {
+		t.Fatalf("should've paused foo: %#v", driver.PauseID)
+	}
+	if driver.StopCalled {
+		t.Fatal("shouldn't have stopped the container")
+	}
+
+	step.Cleanup(state)
+	if !driver.UnpauseCalled || driver.UnpauseID != "foo" {
+		t.Fatalf("should've resumed foo: %#v", driver.UnpauseID)
+	}
+}
+
+func TestStepStop_pauseRootlessCgroupsV1(t *testing.T) {
+	state := testStepStopState(t)
+	step := new(StepStop)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.PauseBeforeCommit = true
+	driver := state.Get("driver").(*MockDriver)
+	driver.CapabilitiesResult = &Capabilities{Rootless: true, CgroupVersion: 1}
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+	if driver.PauseCalled {
+		t.Fatal("shouldn't have paused the container")
+	}
+}
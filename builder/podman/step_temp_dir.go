@@ -73,7 +73,15 @@ func (s *StepTempDir) Run(ctx context.Context, state multistep.StateBag) multist
 }
 
 func (s *StepTempDir) Cleanup(state multistep.StateBag) {
-	if s.tempDir != "" {
-		os.RemoveAll(s.tempDir) //nolint:errcheck
+	if s.tempDir == "" {
+		return
 	}
+
+	// The container kept for debugging still has the temp dir mounted
+	if _, ok := state.GetOk("container_kept"); ok {
+		log.Printf("Keeping temp dir %s for the kept container", s.tempDir)
+		return
+	}
+
+	os.RemoveAll(s.tempDir) //nolint:errcheck
 }
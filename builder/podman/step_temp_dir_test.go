@@ -50,3 +50,20 @@ func testStepTempDir_impl(t *testing.T) string {
 func TestStepTempDir(t *testing.T) {
 	testStepTempDir_impl(t)
 }
+
+func TestStepTempDir_containerKept(t *testing.T) {
+	state := testState(t)
+	step := new(StepTempDir)
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	dir := state.Get("temp_dir").(string)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	state.Put("container_kept", true)
+	step.Cleanup(state)
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("dir should be kept: %s", err)
+	}
+}
@@ -0,0 +1,143 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepWaitReady waits for the container to be ready before it is provisioned,
+// according to the ready_check option.
+type StepWaitReady struct {
+	// PollInterval is the time between two checks. Defaults to 2 seconds.
+	PollInterval time.Duration
+}
+
+func (s *StepWaitReady) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining podman config") //nolint:staticcheck
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if config.ReadyCheck == "" {
+		return multistep.ActionContinue
+	}
+
+	driver := state.Get("driver").(Driver)
+	containerId := state.Get("container_id").(string)
+
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+
+	ui.Say(fmt.Sprintf("Waiting up to %s for the container to be ready (%s)...",
+		config.ReadyTimeout, config.ReadyCheck))
+
+	deadline := time.Now().Add(config.ReadyTimeout)
+	for {
+		ready, status, err := s.check(ctx, deadline, driver, containerId, config)
+		if err != nil {
+			return s.halt(state, ui, fmt.Errorf("Error checking if the container is ready: %s", err)) //nolint:staticcheck
+		}
+		if ready {
+			ui.Message("Container is ready")
+			return multistep.ActionContinue
+		}
+		log.Printf("Container not ready yet: %s", status)
+
+		cs, err := driver.ContainerState(containerId)
+		if err != nil {
+			return s.halt(state, ui, fmt.Errorf("Error inspecting the container: %s", err)) //nolint:staticcheck
+		}
+		if !cs.Running {
+			return s.halt(state, ui, fmt.Errorf( //nolint:staticcheck
+				"Container stopped while waiting for it to be ready: status %s, exit code %d",
+				cs.Status, cs.ExitCode))
+		}
+
+		// The next check is only run if there's time left for it.
+		wait := time.Until(deadline)
+		if wait > interval {
+			wait = interval
+		}
+		select {
+		case <-ctx.Done():
+			return s.halt(state, ui, fmt.Errorf("Cancelled while waiting for the container to be ready")) //nolint:staticcheck
+		case <-time.After(wait):
+		}
+
+		if !time.Now().Before(deadline) {
+			return s.halt(state, ui, fmt.Errorf( //nolint:staticcheck
+				"Timeout after %s waiting for the container to be ready (%s), last status: %s",
+				config.ReadyTimeout, config.ReadyCheck, status))
+		}
+	}
+}
+
+// check runs the ready check once. It returns whether the container is ready
+// and, if not, a description of its current status. An error is only returned
+// when the check itself can't be run. A check still running at the deadline
+// is killed, and the container isn't ready.
+func (s *StepWaitReady) check(ctx context.Context, deadline time.Time, driver Driver, containerId string, config *Config) (bool, string, error) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	switch config.ReadyCheck {
+	case "healthcheck":
+		healthy, err := driver.Healthcheck(ctx, containerId)
+		if ctx.Err() != nil {
+			return false, "healthcheck timed out", nil
+		}
+		if err != nil {
+			return false, "", err
+		}
+		return healthy, "unhealthy", nil
+	case "command":
+		output, err := driver.Exec(ctx, containerId, []string{"/bin/sh", "-c", config.ReadyCommand})
+		if ctx.Err() != nil {
+			return false, fmt.Sprintf("%q timed out", config.ReadyCommand), nil
+		}
+		if err != nil {
+			return false, fmt.Sprintf("%q failed: %s", config.ReadyCommand, strings.TrimSpace(output)), nil
+		}
+		return true, "", nil
+	case "systemd":
+		// is-system-running exits with a non-zero status unless the system
+		// is running, so only its output is looked at. A degraded system
+		// finished booting but has failed units, which the provisioners may
+		// want to fix.
+		output, _ := driver.Exec(ctx, containerId, []string{"systemctl", "is-system-running"})
+		if ctx.Err() != nil {
+			return false, "systemctl timed out", nil
+		}
+		status := strings.TrimSpace(output)
+		switch status {
+		case "running":
+			return true, status, nil
+		case "degraded":
+			log.Printf("[WARN] systemd reports the system as degraded")
+			return true, status, nil
+		}
+		return false, fmt.Sprintf("systemd is %q", status), nil
+	}
+
+	return false, "", fmt.Errorf("unknown ready check %q", config.ReadyCheck)
+}
+
+func (s *StepWaitReady) halt(state multistep.StateBag, ui packersdk.Ui, err error) multistep.StepAction {
+	state.Put("error", err)
+	ui.Error(err.Error())
+	return multistep.ActionHalt
+}
+
+func (s *StepWaitReady) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,202 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func testStepWaitReadyState(t *testing.T) multistep.StateBag {
+	state := testState(t)
+	state.Put("container_id", "foo")
+	return state
+}
+
+func TestStepWaitReady_impl(t *testing.T) {
+	var _ multistep.Step = new(StepWaitReady)
+}
+
+func TestStepWaitReady_disabled(t *testing.T) {
+	state := testStepWaitReadyState(t)
+	step := new(StepWaitReady)
+	defer step.Cleanup(state)
+
+	driver := state.Get("driver").(*MockDriver)
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we didn't check anything
+	if driver.HealthcheckCalled > 0 || driver.ExecCalled > 0 || driver.ContainerStateCalled {
+		t.Fatal("shouldn't have checked the container")
+	}
+}
+
+func TestStepWaitReady_healthcheck(t *testing.T) {
+	state := testStepWaitReadyState(t)
+	step := new(StepWaitReady)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ReadyCheck = "healthcheck"
+	driver := state.Get("driver").(*MockDriver)
+	driver.HealthcheckHealthy = true
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if driver.HealthcheckCalled != 1 {
+		t.Fatalf("bad: %d", driver.HealthcheckCalled)
+	}
+
+	// A healthcheck that can't run is fatal
+	state = testStepWaitReadyState(t)
+	config = state.Get("config").(*Config)
+	config.ReadyCheck = "healthcheck"
+	driver = state.Get("driver").(*MockDriver)
+	driver.HealthcheckErr = errors.New("no healthcheck defined")
+
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Fatal("should have error")
+	}
+}
+
+func TestStepWaitReady_command(t *testing.T) {
+	state := testStepWaitReadyState(t)
+	step := new(StepWaitReady)
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ReadyCheck = "command"
+	config.ReadyCommand = "test -f /ready"
+	driver := state.Get("driver").(*MockDriver)
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	expected := []string{"/bin/sh", "-c", "test -f /ready"}
+	if !reflect.DeepEqual(driver.ExecCommand, expected) {
+		t.Fatalf("bad: %#v", driver.ExecCommand)
+	}
+}
+
+func TestStepWaitReady_systemd(t *testing.T) {
+	for _, status := range []string{"running\n", "degraded\n"} {
+		state := testStepWaitReadyState(t)
+		step := new(StepWaitReady)
+
+		config := state.Get("config").(*Config)
+		config.ReadyCheck = "systemd"
+		driver := state.Get("driver").(*MockDriver)
+		driver.ExecOutput = status
+		if status != "running\n" {
+			driver.ExecErr = errors.New("exit status 1")
+		}
+
+		// run the step
+		if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+			t.Fatalf("bad action for %q: %#v", status, action)
+		}
+
+		expected := []string{"systemctl", "is-system-running"}
+		if !reflect.DeepEqual(driver.ExecCommand, expected) {
+			t.Fatalf("bad: %#v", driver.ExecCommand)
+		}
+	}
+}
+
+func TestStepWaitReady_timeout(t *testing.T) {
+	state := testStepWaitReadyState(t)
+	step := &StepWaitReady{PollInterval: time.Millisecond}
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ReadyCheck = "systemd"
+	config.ReadyTimeout = 20 * time.Millisecond
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExecOutput = "starting\n"
+	driver.ExecErr = errors.New("exit status 1")
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we retried and report the last status
+	if driver.ExecCalled < 2 {
+		t.Fatalf("should've retried: %d", driver.ExecCalled)
+	}
+	err := state.Get("error").(error)
+	if !strings.Contains(err.Error(), `systemd is "starting"`) {
+		t.Fatalf("bad error: %s", err)
+	}
+}
+
+func TestStepWaitReady_hangingCommand(t *testing.T) {
+	state := testStepWaitReadyState(t)
+	step := &StepWaitReady{PollInterval: time.Millisecond}
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ReadyCheck = "command"
+	config.ReadyCommand = "sleep infinity"
+	config.ReadyTimeout = 200 * time.Millisecond
+	driver := state.Get("driver").(*MockDriver)
+	driver.ExecHang = true
+
+	// run the step
+	start := time.Now()
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify the probe was killed at the deadline
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("should have stopped waiting after the timeout: %s", elapsed)
+	}
+	if driver.ExecCalled != 1 {
+		t.Fatalf("bad: %d", driver.ExecCalled)
+	}
+	err := state.Get("error").(error)
+	if !strings.Contains(err.Error(), `"sleep infinity" timed out`) {
+		t.Fatalf("bad error: %s", err)
+	}
+}
+
+func TestStepWaitReady_containerStopped(t *testing.T) {
+	state := testStepWaitReadyState(t)
+	step := &StepWaitReady{PollInterval: time.Millisecond}
+	defer step.Cleanup(state)
+
+	config := state.Get("config").(*Config)
+	config.ReadyCheck = "healthcheck"
+	driver := state.Get("driver").(*MockDriver)
+	driver.ContainerStateResult = &ContainerState{Status: "exited", ExitCode: 137}
+
+	// run the step
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("bad action: %#v", action)
+	}
+
+	// verify we failed right away
+	if driver.HealthcheckCalled != 1 {
+		t.Fatalf("shouldn't have retried: %d", driver.HealthcheckCalled)
+	}
+	err := state.Get("error").(error)
+	if !strings.Contains(err.Error(), "exit code 137") {
+		t.Fatalf("bad error: %s", err)
+	}
+}
@@ -0,0 +1,229 @@
+package podman
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// xattrPrefix is the prefix of the PAX records holding extended attributes.
+const xattrPrefix = "SCHILY.xattr."
+
+// unpacker extracts the tar stream of `podman export` to a directory,
+// preserving ownership, modes, extended attributes, hard links and device
+// nodes where possible. Whatever can't be preserved, for example ownership
+// when not running as root, is logged once and skipped.
+type unpacker struct {
+	// dst is the directory the stream is extracted to.
+	dst string
+	// excludes are globs of the paths in the container that aren't
+	// extracted, along with their content, like /var/cache/*.
+	excludes pathFilter
+
+	// dirs are the directories extracted, whose modes and times are set at
+	// the end, once their content is written.
+	dirs []*tar.Header
+	// warned holds the kinds of failures that were already logged.
+	warned map[string]bool
+}
+
+func newUnpacker(dst string, excludes pathFilter) *unpacker {
+	return &unpacker{
+		dst:      dst,
+		excludes: excludes,
+		warned:   map[string]bool{},
+	}
+}
+
+// Unpack extracts the tar stream read from r.
+func (u *unpacker) Unpack(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading export: %s", err) //nolint:staticcheck
+		}
+
+		name := containerPath(hdr.Name)
+		if name == "/" {
+			u.dirs = append(u.dirs, hdr)
+			continue
+		}
+		if u.excludes.Match(name) {
+			continue
+		}
+
+		if err := u.extract(tr, hdr, name); err != nil {
+			return fmt.Errorf("Error extracting %s: %s", name, err) //nolint:staticcheck
+		}
+	}
+
+	// Deepest directories first, so that setting the times of a directory
+	// isn't undone by changes to its subdirectories.
+	for i := len(u.dirs) - 1; i >= 0; i-- {
+		hdr := u.dirs[i]
+		target := u.target(containerPath(hdr.Name))
+		if err := os.Chmod(target, hdr.FileInfo().Mode()); err != nil {
+			return err
+		}
+		u.chtimes(target, hdr)
+	}
+
+	return nil
+}
+
+func (u *unpacker) extract(tr *tar.Reader, hdr *tar.Header, name string) error {
+	target := u.target(name)
+	mode := hdr.FileInfo().Mode()
+
+	if err := u.checkParents(name); err != nil {
+		return err
+	}
+	// Parents missing from the stream get the default mode
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		// The directory is kept writable until its content is extracted
+		if err := os.Mkdir(target, 0700); os.IsExist(err) {
+			// Only a directory created by a parent, not a symlink, which
+			// would be followed by chmod.
+			if fi, err := os.Lstat(target); err != nil || !fi.IsDir() {
+				return fmt.Errorf("%s already exists and isn't a directory", name)
+			}
+		} else if err != nil {
+			return err
+		}
+		u.dirs = append(u.dirs, hdr)
+	case tar.TypeReg:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close() //nolint:errcheck
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		source := containerPath(hdr.Linkname)
+		if u.excludes.Match(source) {
+			log.Printf("Skipping %s, a hard link to the excluded %s", name, source)
+			return nil
+		}
+		if err := u.checkParents(source); err != nil {
+			return err
+		}
+		// The link shares the inode, and so the ownership, mode and
+		// attributes of its source.
+		return os.Link(u.target(source), target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if err := mknod(target, hdr); err != nil {
+			u.warn("devices", "Can't create device nodes, like %s: %s", name, err)
+			return nil
+		}
+	default:
+		log.Printf("Skipping %s of unsupported type %q", name, hdr.Typeflag)
+		return nil
+	}
+
+	if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+		u.warn("ownership", "Can't preserve the ownership of the files, like %s: %s", name, err)
+	}
+	for key, value := range hdr.PAXRecords {
+		if attr, ok := strings.CutPrefix(key, xattrPrefix); ok {
+			if err := lsetxattr(target, attr, value); err != nil {
+				u.warn("xattr "+attr, "Can't preserve the %s extended attribute, like on %s: %s", attr, name, err)
+			}
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeDir {
+		return nil
+	}
+	// After chown, which clears the setuid and setgid bits
+	if err := os.Chmod(target, mode); err != nil {
+		return err
+	}
+	u.chtimes(target, hdr)
+
+	return nil
+}
+
+// target returns where the path in the container is extracted. Cleaning the
+// path as an absolute path first keeps it inside the destination.
+func (u *unpacker) target(name string) string {
+	return filepath.Join(u.dst, filepath.FromSlash(name))
+}
+
+// checkParents returns an error if a parent of the path in the container is a
+// symlink in the destination. Cleaning the path only keeps it inside the
+// destination lexically: a symlink of the image, like etc -> /etc, would
+// make the following entries, like etc/passwd, be written out of it, on the
+// host.
+func (u *unpacker) checkParents(name string) error {
+	dir := u.dst
+	for _, part := range strings.Split(strings.TrimPrefix(path.Dir(name), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			// Created by MkdirAll, as a directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is under %s, which isn't a directory", name, containerPath(strings.TrimPrefix(dir, u.dst)))
+		}
+	}
+	return nil
+}
+
+func (u *unpacker) chtimes(target string, hdr *tar.Header) {
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	if err := os.Chtimes(target, atime, hdr.ModTime); err != nil {
+		u.warn("times", "Can't preserve the times of the files, like %s: %s", target, err)
+	}
+}
+
+// warn logs a failure to preserve something, once for each kind.
+func (u *unpacker) warn(kind string, format string, args ...interface{}) {
+	if u.warned[kind] {
+		return
+	}
+	u.warned[kind] = true
+	log.Printf("[WARN] "+format, args...)
+}
+
+// containerPath returns the absolute path in the container of a tar entry.
+func containerPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// errNotSupported is returned when extracting something isn't supported on
+// this platform.
+var errNotSupported = errors.New("not supported on this platform")
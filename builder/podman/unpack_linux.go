@@ -0,0 +1,28 @@
+package podman
+
+import (
+	"archive/tar"
+
+	"golang.org/x/sys/unix"
+)
+
+// mknod creates the device node or FIFO described by the tar entry.
+func mknod(target string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	}
+
+	dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+	return unix.Mknod(target, mode, int(dev))
+}
+
+// lsetxattr sets an extended attribute, without following symlinks.
+func lsetxattr(target string, attr string, value string) error {
+	return unix.Lsetxattr(target, attr, []byte(value), 0)
+}
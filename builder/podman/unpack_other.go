@@ -0,0 +1,13 @@
+//go:build !linux
+
+package podman
+
+import "archive/tar"
+
+func mknod(target string, hdr *tar.Header) error {
+	return errNotSupported
+}
+
+func lsetxattr(target string, attr string, value string) error {
+	return errNotSupported
+}
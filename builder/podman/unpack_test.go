@@ -0,0 +1,182 @@
+package podman
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// testTar returns a tar like the ones of podman export.
+func testTar(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	entries := []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "etc/hostname", Typeflag: tar.TypeReg, Mode: 0644}, data: "web\n"},
+		{hdr: tar.Header{Name: "etc/hostname.link", Typeflag: tar.TypeLink, Linkname: "etc/hostname"}},
+		{hdr: tar.Header{Name: "etc/localtime", Typeflag: tar.TypeSymlink, Linkname: "../usr/share/zoneinfo/UTC"}},
+		{hdr: tar.Header{Name: "readonly/", Typeflag: tar.TypeDir, Mode: 0555}},
+		{hdr: tar.Header{Name: "readonly/file", Typeflag: tar.TypeReg, Mode: 0400, Uid: 1000, Gid: 1000}, data: "ro"},
+		{hdr: tar.Header{Name: "usr/bin/tool", Typeflag: tar.TypeReg, Mode: 04755}, data: "#!/bin/sh\n"},
+		{hdr: tar.Header{Name: "run/initctl", Typeflag: tar.TypeFifo, Mode: 0600}},
+		{hdr: tar.Header{Name: "var/cache/dnf/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "var/cache/dnf/packages", Typeflag: tar.TypeReg, Mode: 0644}, data: "cached"},
+		{hdr: tar.Header{Name: "var/cache/dnf.link", Typeflag: tar.TypeLink, Linkname: "var/cache/dnf/packages"}},
+		{hdr: tar.Header{Name: "../../escape", Typeflag: tar.TypeReg, Mode: 0644}, data: "contained"},
+	}
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.data))
+		hdr.ModTime = modTime
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return &buf
+}
+
+func TestUnpacker(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix filesystems only")
+	}
+	dst := t.TempDir()
+
+	u := newUnpacker(dst, []string{"/var/cache/*"})
+	if err := u.Unpack(testTar(t)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// Let t.TempDir remove the read-only directory
+	t.Cleanup(func() { os.Chmod(filepath.Join(dst, "readonly"), 0755) }) //nolint:errcheck
+
+	data, err := os.ReadFile(filepath.Join(dst, "etc", "hostname"))
+	if err != nil || string(data) != "web\n" {
+		t.Fatalf("bad file: %q %v", data, err)
+	}
+
+	// hard links share the inode of their source
+	fi, err := os.Stat(filepath.Join(dst, "etc", "hostname"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	link, err := os.Stat(filepath.Join(dst, "etc", "hostname.link"))
+	if err != nil || !os.SameFile(fi, link) {
+		t.Fatalf("bad hard link: %v", err)
+	}
+
+	if target, err := os.Readlink(filepath.Join(dst, "etc", "localtime")); err != nil || target != "../usr/share/zoneinfo/UTC" {
+		t.Fatalf("bad symlink: %q %v", target, err)
+	}
+
+	// modes are preserved, including on directories and setuid bits
+	modes := map[string]os.FileMode{
+		"":              os.ModeDir | 0755,
+		"readonly":      os.ModeDir | 0555,
+		"readonly/file": 0400,
+		"usr/bin/tool":  os.ModeSetuid | 0755,
+	}
+	for name, mode := range modes {
+		fi, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.Mode() != mode {
+			t.Fatalf("bad mode of %q: %s", name, fi.Mode())
+		}
+		if !fi.ModTime().Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Fatalf("bad time of %q: %s", name, fi.ModTime())
+		}
+	}
+
+	// excluded paths and the hard links to them are skipped
+	for _, name := range []string{"var/cache/dnf", "var/cache/dnf.link"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); err == nil {
+			t.Fatalf("%s should be excluded", name)
+		}
+	}
+
+	// entries can't escape the destination
+	if data, err := os.ReadFile(filepath.Join(dst, "escape")); err != nil || string(data) != "contained" {
+		t.Fatalf("bad file: %q %v", data, err)
+	}
+
+	if runtime.GOOS == "linux" {
+		if fi, err := os.Lstat(filepath.Join(dst, "run", "initctl")); err != nil || fi.Mode()&os.ModeNamedPipe == 0 {
+			t.Fatalf("bad fifo: %v", err)
+		}
+	}
+}
+
+func TestUnpacker_symlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix filesystems only")
+	}
+	outside := t.TempDir()
+	outsideInfo, err := os.Stat(outside)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := map[string][]tar.Header{
+		"file": {
+			{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"relative": {
+			{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "../../../../../../../../" + outside},
+			{Name: "etc/sub/passwd", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"directory": {
+			{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0777},
+		},
+		"hard link": {
+			{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "etc/passwd"},
+		},
+	}
+	for name, hdrs := range cases {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range hdrs {
+			hdr := hdr
+			if err := tw.WriteHeader(&hdr); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if err := newUnpacker(t.TempDir(), nil).Unpack(&buf); err == nil {
+			t.Fatalf("%s: should error", name)
+		}
+		entries, err := os.ReadDir(outside)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(entries) > 0 {
+			t.Fatalf("%s: wrote out of the destination: %s", name, entries[0].Name())
+		}
+		fi, err := os.Stat(outside)
+		if err != nil || fi.Mode() != outsideInfo.Mode() {
+			t.Fatalf("%s: changed the mode out of the destination: %v %v", name, fi.Mode(), err)
+		}
+	}
+}